@@ -42,8 +42,11 @@ import {
   getAllStats,
   updateDailyStreak,
 } from "@/app/redux/slices/statsSlice/asyncActions";
+import { fetchChatUnread } from "@/app/redux/slices/chatSlice/asyncActions";
 import { useToggleStateOutside } from "@/app/hooks/useToggleStateOutside";
 
+const UNREAD_POLL_INTERVAL = 60 * 1000;
+
 const UserMenu = lazy(() => import("./UserMenu/UserMenu"));
 
 // Memoized icon components
@@ -155,6 +158,7 @@ const Header: React.FC<HeaderProps> = ({
 
   const dispatch: AppDispatch = useDispatch();
   const { currentStreak } = useSelector((state: RootState) => state.stats);
+  const { unreadTotal } = useSelector((state: RootState) => state.chat);
 
   const context = useContext(MyContext);
   if (!context) {
@@ -296,6 +300,16 @@ const Header: React.FC<HeaderProps> = ({
       });
   }, [dispatch]);
 
+  //unread chat messages badge, messages come to other rooms without socket so it is polled
+  useEffect(() => {
+    dispatch(fetchChatUnread());
+    const intervalId = window.setInterval(
+      () => dispatch(fetchChatUnread()),
+      UNREAD_POLL_INTERVAL,
+    );
+    return () => clearInterval(intervalId);
+  }, [dispatch]);
+
   const handlers = useMemo(
     () => ({
       opacity: (e: React.ChangeEvent<HTMLInputElement>) =>
@@ -489,7 +503,7 @@ const Header: React.FC<HeaderProps> = ({
 
         {/* user dropdown menu */}
         <div
-          className="flex items-center  p-1 hover:bg-neutral-600 dark:hover:bg-neutral-300 hover:rounded-md  cursor-pointer transition-all "
+          className="relative flex items-center  p-1 hover:bg-neutral-600 dark:hover:bg-neutral-300 hover:rounded-md  cursor-pointer transition-all "
           onClick={toggleOpenUserMenu}
         >
           <LuUserRound
@@ -497,6 +511,14 @@ const Header: React.FC<HeaderProps> = ({
             color={theme === "dark" ? "#4e4e4e" : "white"}
             className="mr-[2px]"
           />
+          {unreadTotal > 0 && (
+            <span
+              className="absolute -top-1 left-4 min-w-[16px] h-[16px] px-[3px] rounded-full bg-[#e89688] text-[10px] leading-[16px] text-center text-white"
+              title="unread messages"
+            >
+              {unreadTotal > 99 ? "99+" : unreadTotal}
+            </span>
+          )}
           {openUserMenu ? (
             <MdOutlineKeyboardArrowUp
               color={theme === "dark" ? "#4e4e4e" : "white"}
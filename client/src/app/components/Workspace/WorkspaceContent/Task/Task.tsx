@@ -9,6 +9,7 @@ import React, {
 } from "react";
 
 import { useToggleStateOutside } from "@/app/hooks/useToggleStateOutside";
+import { useTaskEvents } from "@/app/hooks/useTaskEvents";
 
 import { MyContext } from "../../Workspace";
 import TaskContent from "@/app/components/Workspace/WorkspaceContent/Task/TaskContent/TaskContent";
@@ -233,6 +234,9 @@ const Task: React.FC<TodoProps> = ({
     return () => clearTimeout(timeoutId);
   }, [hideCompleted, showTodayOnly, dispatch]);
 
+  //apply changes made in other sessions without refetch
+  useTaskEvents({ hideCompleted, showTodayOnly });
+
   return (
     <div
       onMouseDown={() => setActiveWidget("todo")}
@@ -1,7 +1,7 @@
 import {
   completeTask,
   deleteTask,
-  UpdateTaskOrder,
+  moveTask,
 } from "@/app/redux/slices/taskSlice/asyncActions";
 import { reorderTasks } from "@/app/redux/slices/taskSlice/taskSlice";
 import { AppDispatch, RootState } from "@/app/redux/store";
@@ -85,19 +85,16 @@ const TaskContent = () => {
 
         const newTasks = arrayMove(tasks, oldIndex, newIndex);
 
-        const updatedTasks = newTasks.map((task, index) => ({
-          ...task,
-          Order: index + 1,
-        }));
+        dispatch(reorderTasks(newTasks));
 
-        dispatch(reorderTasks(updatedTasks));
-
-        const orderUpdates = newTasks.map((task, index) => ({
-          localId: task.LocalID,
-          order: index + 1,
-        }));
-
-        dispatch(UpdateTaskOrder(orderUpdates));
+        //server places moved task between its new neighbours
+        dispatch(
+          moveTask({
+            id: newTasks[newIndex].LocalID,
+            after: newTasks[newIndex - 1]?.LocalID,
+            before: newTasks[newIndex + 1]?.LocalID,
+          })
+        );
       }
 
       setActiveId(null);
@@ -9,6 +9,8 @@ import {
 import {
   connectToChat,
   disconnectFromChat,
+  fetchChatHistory,
+  markChatRead,
   sendMessage,
 } from "../redux/slices/chatSlice/asyncActions";
 import { ChatState, Message } from "../utility/types/reduxTypes";
@@ -31,6 +33,16 @@ export const useChat = () => {
         try {
           const message: Message = JSON.parse(event.data);
           dispatch(receiveMessage(message));
+
+          //message shown in open chat is read right away
+          if (message.id && message.senderID === chatState.targetUserID) {
+            dispatch(
+              markChatRead({
+                targetUserID: message.senderID,
+                messageID: message.id,
+              })
+            );
+          }
         } catch {
           console.error("Incoming message parsing error");
         }
@@ -48,17 +60,30 @@ export const useChat = () => {
         chatState.ws?.removeEventListener("error", handleError);
       };
     }
-  }, [chatState.ws, dispatch]);
+  }, [chatState.ws, chatState.targetUserID, dispatch]);
 
   const connectToUserChat = useCallback(
     (currentUserID: string, targetUserID: string) => {
       dispatch(setCurrentUserID(currentUserID));
       dispatch(setTargetUserID(targetUserID));
-      dispatch(connectToChat({ currentUserID, targetUserID }));
+      dispatch(connectToChat({ currentUserID, targetUserID }))
+        .unwrap()
+        .then(() => dispatch(fetchChatHistory({ targetUserID })).unwrap())
+        .then(() => dispatch(markChatRead({ targetUserID })))
+        .catch(() => {});
     },
     [dispatch]
   );
 
+  const loadOlderMessages = useCallback(() => {
+    const cursor = chatState.activeRoom?.nextCursor;
+    if (cursor && chatState.targetUserID) {
+      dispatch(
+        fetchChatHistory({ targetUserID: chatState.targetUserID, cursor })
+      );
+    }
+  }, [dispatch, chatState.activeRoom?.nextCursor, chatState.targetUserID]);
+
   const sendChatMessage = useCallback(
     (body: string) => {
       if (chatState.currentUserID && chatState.targetUserID) {
@@ -92,6 +117,7 @@ export const useChat = () => {
   return {
     ...chatState,
     connectToUserChat,
+    loadOlderMessages,
     sendChatMessage,
     disconnectChat,
     updateTargetUserID,
@@ -0,0 +1,68 @@
+import { useEffect } from "react";
+import { useDispatch } from "react-redux";
+import { AppDispatch } from "../redux/store";
+import { clientID } from "../redux/api";
+import { applyTaskEvent } from "../redux/slices/taskSlice/taskSlice";
+import { getAllTasks } from "../redux/slices/taskSlice/asyncActions";
+import { TaskEvent } from "../utility/types/reduxTypes";
+
+const RECONNECT_DELAY = 3000;
+
+//keep tasks in sync with changes made in other tabs and devices
+export const useTaskEvents = (filters: {
+  hideCompleted: boolean;
+  showTodayOnly: boolean;
+}) => {
+  const dispatch = useDispatch<AppDispatch>();
+  const { hideCompleted, showTodayOnly } = filters;
+
+  useEffect(() => {
+    const wsUrl =
+      (process.env.NEXT_PUBLIC_API_URL || "http://localhost:8000").replace(
+        /^http/,
+        "ws"
+      ) + "/tasks/live";
+
+    let ws: WebSocket | null = null;
+    let reconnectTimeout: ReturnType<typeof setTimeout> | undefined;
+    let closed = false;
+    let reconnecting = false;
+
+    const connect = () => {
+      ws = new WebSocket(wsUrl);
+
+      ws.onopen = () => {
+        //events sent while socket was down are lost, so load list again
+        if (reconnecting) {
+          dispatch(getAllTasks({ hideCompleted, showTodayOnly }));
+        }
+      };
+
+      ws.onmessage = (message: MessageEvent) => {
+        try {
+          const event: TaskEvent = JSON.parse(message.data);
+          if (event.origin !== clientID) {
+            dispatch(applyTaskEvent(event));
+          }
+        } catch {
+          console.error("Task event parsing error");
+        }
+      };
+
+      ws.onclose = () => {
+        if (!closed) {
+          reconnecting = true;
+          reconnectTimeout = setTimeout(connect, RECONNECT_DELAY);
+        }
+      };
+    };
+
+    connect();
+
+    return () => {
+      closed = true;
+      clearTimeout(reconnectTimeout);
+      ws?.close();
+    };
+  }, [dispatch, hideCompleted, showTodayOnly]);
+};
@@ -12,9 +12,13 @@ interface QueueItem {
   reject: (reason?: unknown) => void;
 }
 
+//id of this tab, server sends it back in task events so own changes are skipped
+export const clientID = Math.random().toString(36).slice(2);
+
 const api = axios.create({
   baseURL: process.env.NEXT_PUBLIC_API_URL,
   withCredentials: true,
+  headers: { "X-Client-ID": clientID },
 });
 
 let isRefreshing = false;
@@ -1,9 +1,15 @@
 import {
+  ChatHistoryResponse,
   ChatState,
+  ChatUnreadResponse,
   ConnectToChatParams,
+  FetchChatHistoryParams,
+  MarkChatReadParams,
   Message,
 } from "@/app/utility/types/reduxTypes";
 import { createAsyncThunk } from "@reduxjs/toolkit";
+import { AxiosError } from "axios";
+import api from "../../api";
 
 export const connectToChat = createAsyncThunk(
   "chat/connectToChat",
@@ -50,6 +56,58 @@ export const connectToChat = createAsyncThunk(
   }
 );
 
+//saved messages of conversation, without cursor the most recent page is loaded
+export const fetchChatHistory = createAsyncThunk(
+  "chat/fetchChatHistory",
+  async ({ targetUserID, cursor }: FetchChatHistoryParams, thunkAPI) => {
+    try {
+      const res = await api.get<ChatHistoryResponse>("/chat/history", {
+        params: { chatWithID: targetUserID, cursor },
+      });
+      return res.data;
+    } catch (error) {
+      const axiosError = error as AxiosError;
+      return thunkAPI.rejectWithValue(
+        axiosError.response?.data || { error: "Failed to load chat history" }
+      );
+    }
+  }
+);
+
+export const fetchChatUnread = createAsyncThunk(
+  "chat/fetchChatUnread",
+  async (_, thunkAPI) => {
+    try {
+      const res = await api.get<ChatUnreadResponse>("/chat/unread");
+      return res.data;
+    } catch (error) {
+      const axiosError = error as AxiosError;
+      return thunkAPI.rejectWithValue(
+        axiosError.response?.data || { error: "Failed to load unread messages" }
+      );
+    }
+  }
+);
+
+//without messageID whole conversation is read
+export const markChatRead = createAsyncThunk(
+  "chat/markChatRead",
+  async ({ targetUserID, messageID }: MarkChatReadParams, thunkAPI) => {
+    try {
+      const res = await api.put<{ lastReadID: number; total: number }>(
+        "/chat/read",
+        { chatWithID: targetUserID, messageID }
+      );
+      return res.data;
+    } catch (error) {
+      const axiosError = error as AxiosError;
+      return thunkAPI.rejectWithValue(
+        axiosError.response?.data || { error: "Failed to mark messages read" }
+      );
+    }
+  }
+);
+
 export const sendMessage = createAsyncThunk(
   "chat/sendMessage",
   async (message: Omit<Message, "timestamp">, thunkAPI) => {
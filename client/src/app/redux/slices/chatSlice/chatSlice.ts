@@ -3,7 +3,14 @@ import {
   ChatState,
   Message,
 } from "@/app/utility/types/reduxTypes";
-import { connectToChat, disconnectFromChat, sendMessage } from "./asyncActions";
+import {
+  connectToChat,
+  disconnectFromChat,
+  fetchChatHistory,
+  fetchChatUnread,
+  markChatRead,
+  sendMessage,
+} from "./asyncActions";
 import { createSlice, PayloadAction } from "@reduxjs/toolkit";
 
 const initialState: ChatState = {
@@ -14,6 +21,7 @@ const initialState: ChatState = {
   error: null,
   targetUserID: "",
   currentUserID: null,
+  unreadTotal: 0,
 };
 
 const chatSlice = createSlice({
@@ -76,6 +84,33 @@ const chatSlice = createSlice({
           (action.payload as ChatErrorPayload)?.error || "Connection failed";
       })
 
+      // History goes before live messages, ones which came while it loaded are skipped
+      .addCase(fetchChatHistory.fulfilled, (state, action) => {
+        if (state.activeRoom) {
+          const known = new Set(
+            state.activeRoom.messages.map((message) => message.id)
+          );
+          const older = action.payload.data.filter(
+            (message) => !known.has(message.id)
+          );
+          state.activeRoom.messages = [...older, ...state.activeRoom.messages];
+          state.activeRoom.nextCursor = action.payload.nextCursor;
+        }
+      })
+      .addCase(fetchChatHistory.rejected, (state, action) => {
+        state.error =
+          (action.payload as ChatErrorPayload)?.error ||
+          "Failed to load chat history";
+      })
+
+      // Unread badge
+      .addCase(fetchChatUnread.fulfilled, (state, action) => {
+        state.unreadTotal = action.payload.total;
+      })
+      .addCase(markChatRead.fulfilled, (state, action) => {
+        state.unreadTotal = action.payload.total;
+      })
+
       // Send message(duplicates)
       // .addCase(sendMessage.fulfilled, (state, action) => {
       //   if (state.activeRoom) {
@@ -1,6 +1,11 @@
 import { createAsyncThunk } from "@reduxjs/toolkit";
 import api from "../../api";
 import { AxiosError } from "axios";
+import type { RootState } from "../../store";
+
+//version of task known to client, server rejects changes of stale tasks
+const getTaskVersion = (state: RootState, id: number) =>
+  state.tasks.tasks.find((task) => task.LocalID === id)?.Version;
 
 export const getAllTasks = createAsyncThunk(
   "tasks/getAllTasks",
@@ -47,7 +52,8 @@ export const updateTaskTitle = createAsyncThunk(
   "tasks/updateTaskTitle",
   async ({ id, title }: { id: number; title: string }, thunkAPI) => {
     try {
-      const res = await api.put(`/task/update-title/${id}`, { title });
+      const version = getTaskVersion(thunkAPI.getState() as RootState, id);
+      const res = await api.put(`/task/update-title/${id}`, { title, version });
       return res.data;
     } catch (error) {
       const axiosError = error as AxiosError;
@@ -65,8 +71,10 @@ export const updateTaskDescription = createAsyncThunk(
     thunkAPI
   ) => {
     try {
+      const version = getTaskVersion(thunkAPI.getState() as RootState, id);
       const res = await api.put(`/task/update-description/${id}`, {
         description,
+        version,
       });
       return res.data;
     } catch (error) {
@@ -82,7 +90,8 @@ export const completeTask = createAsyncThunk(
   "tasks/completeTask",
   async ({ id, completed }: { id: number; completed: boolean }, thunkAPI) => {
     try {
-      const res = await api.put(`/task/complete/${id}`, { completed });
+      const version = getTaskVersion(thunkAPI.getState() as RootState, id);
+      const res = await api.put(`/task/complete/${id}`, { completed, version });
       return res.data;
     } catch (error) {
       const axiosError = error as AxiosError;
@@ -142,7 +151,14 @@ export const UpdateTaskOrder = createAsyncThunk(
   "tasks/UpdateTaskOrder",
   async (orderData: { localId: number; order: number }[], thunkAPI) => {
     try {
-      const res = await api.put("/tasks/order", orderData);
+      const state = thunkAPI.getState() as RootState;
+      const res = await api.put(
+        "/tasks/order",
+        orderData.map((item) => ({
+          ...item,
+          version: getTaskVersion(state, item.localId),
+        }))
+      );
       return res.data;
     } catch (error) {
       const axiosError = error as AxiosError;
@@ -152,3 +168,22 @@ export const UpdateTaskOrder = createAsyncThunk(
     }
   }
 );
+
+export const moveTask = createAsyncThunk(
+  "tasks/moveTask",
+  async (
+    { id, after, before }: { id: number; after?: number; before?: number },
+    thunkAPI
+  ) => {
+    try {
+      const version = getTaskVersion(thunkAPI.getState() as RootState, id);
+      const res = await api.put(`/task/move/${id}`, { after, before, version });
+      return res.data;
+    } catch (error) {
+      const axiosError = error as AxiosError;
+      return thunkAPI.rejectWithValue(
+        axiosError.response?.data || "Cannot move task"
+      );
+    }
+  }
+);
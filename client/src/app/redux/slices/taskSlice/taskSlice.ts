@@ -6,11 +6,17 @@ import {
   deleteAllTasks,
   deleteTask,
   getAllTasks,
+  moveTask,
   updateTaskDescription,
   UpdateTaskOrder,
   updateTaskTitle,
 } from "./asyncActions";
-import { TaskErrorPayload, TaskState } from "@/app/utility/types/reduxTypes";
+import {
+  Task,
+  TaskErrorPayload,
+  TaskEvent,
+  TaskState,
+} from "@/app/utility/types/reduxTypes";
 
 const initialState: TaskState = {
   tasks: [],
@@ -31,6 +37,18 @@ const resetStates = (state: TaskState) => {
   state.createDescriptionError = null;
 };
 
+//put server copies of tasks in place of local ones
+const replaceTasks = (state: TaskState, tasks: Task[]) => {
+  tasks.forEach((updatedTask) => {
+    const index = state.tasks.findIndex(
+      (task) => task.LocalID === updatedTask.LocalID
+    );
+    if (index !== -1) {
+      state.tasks[index] = updatedTask;
+    }
+  });
+};
+
 const taskSlice = createSlice({
   name: "tasks",
   initialState,
@@ -44,6 +62,29 @@ const taskSlice = createSlice({
     clearUpdateErrors: (state) => {
       resetStates(state);
     },
+
+    //apply change made in another session, local copy wins only if it is newer
+    applyTaskEvent: (state, action: PayloadAction<TaskEvent>) => {
+      const event = action.payload;
+
+      if (event.type === "deleted") {
+        const removed = new Set(event.localIds || []);
+        state.tasks = state.tasks.filter((task) => !removed.has(task.LocalID));
+        return;
+      }
+
+      (event.tasks || []).forEach((eventTask) => {
+        const index = state.tasks.findIndex(
+          (task) => task.LocalID === eventTask.LocalID
+        );
+        if (index === -1) {
+          state.tasks.push(eventTask);
+        } else if (state.tasks[index].Version <= eventTask.Version) {
+          state.tasks[index] = eventTask;
+        }
+      });
+      state.tasks.sort((a, b) => a.Order - b.Order);
+    },
   },
   extraReducers: (builder) => {
     builder
@@ -98,6 +139,9 @@ const taskSlice = createSlice({
         if (index !== -1) {
           state.tasks[index] = updatedTask;
         }
+
+        //tasks waiting for completed one
+        replaceTasks(state, action.payload.dependents || []);
       })
 
       //delete task
@@ -121,8 +165,15 @@ const taskSlice = createSlice({
       })
 
       //update task order
-      .addCase(UpdateTaskOrder.fulfilled, (state) => {
+      .addCase(UpdateTaskOrder.fulfilled, (state, action) => {
         state.isLoading = false;
+        replaceTasks(state, action.payload.data || []);
+      })
+
+      //move task
+      .addCase(moveTask.fulfilled, (state, action) => {
+        state.isLoading = false;
+        replaceTasks(state, [action.payload.data]);
       })
 
       .addMatcher(
@@ -146,11 +197,20 @@ const taskSlice = createSlice({
             action.payload?.updateDescriptionError || null;
 
           state.error = action.payload?.error || null;
+
+          //on conflict server sends its copy of changed tasks
+          if (action.payload?.data) {
+            replaceTasks(state, ([] as Task[]).concat(action.payload.data));
+          }
         }
       );
   },
 });
 
-export const { reorderTasks, clearCreateErrors, clearUpdateErrors } =
-  taskSlice.actions;
+export const {
+  reorderTasks,
+  clearCreateErrors,
+  clearUpdateErrors,
+  applyTaskEvent,
+} = taskSlice.actions;
 export default taskSlice.reducer;
@@ -80,6 +80,21 @@ export interface Task {
   Description: string;
   Completed: boolean;
   Order: number;
+  Version: number;
+  BlockedBy?: number[];
+  Blocked?: boolean;
+  DeferUntil?: string | null;
+  Inbox?: boolean;
+  CompletedAt?: string | null;
+  ArchivedAt?: string | null;
+}
+
+//change of task list pushed by server from other sessions
+export interface TaskEvent {
+  type: "created" | "updated" | "completed" | "reordered" | "deleted";
+  tasks?: Task[];
+  localIds?: number[];
+  origin?: string;
 }
 
 export interface TaskState {
@@ -95,6 +110,7 @@ export interface TaskState {
 
 export interface TaskErrorPayload {
   error?: string;
+  data?: Task | Task[];
   createTitleError?: string | null;
   createDescriptionError?: string | null;
   updateTitleError?: string | null;
@@ -121,9 +137,12 @@ export interface ChatRoom {
   participantB: string;
   messages: Message[];
   isConnected: boolean;
+  //cursor of older messages, empty when whole history is loaded
+  nextCursor?: string;
 }
 
 export interface Message {
+  id?: number;
   senderID: string;
   receiverID: string;
   body: string;
@@ -138,6 +157,8 @@ export interface ChatState {
   error: string | null;
   targetUserID: string;
   currentUserID: string | null;
+  //unread messages of all conversations, shown as header badge
+  unreadTotal: number;
 }
 
 export interface ChatErrorPayload {
@@ -148,3 +169,32 @@ export interface ConnectToChatParams {
   currentUserID: string;
   targetUserID: string;
 }
+
+export interface FetchChatHistoryParams {
+  targetUserID: string;
+  cursor?: string;
+}
+
+export interface ChatHistoryResponse {
+  data: Message[];
+  nextCursor: string;
+  lastReadID: number;
+  peerOnline: boolean;
+}
+
+export interface ChatUnread {
+  chatWithID: string;
+  unread: number;
+  lastReadID: number;
+  lastMessageID: number;
+}
+
+export interface ChatUnreadResponse {
+  total: number;
+  conversations: ChatUnread[];
+}
+
+export interface MarkChatReadParams {
+  targetUserID: string;
+  messageID?: number;
+}
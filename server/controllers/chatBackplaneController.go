@@ -0,0 +1,225 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"server/initializers"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// messages of rooms go through redis, so users connected to different instances can talk.
+// every instance still delivers to its own connections directly, without redis it works alone
+const (
+	ChatChannelPrefix     = "chat:room:"
+	ChatMembersTTL        = 90 * time.Second
+	ChatHeartbeatInterval = 30 * time.Second
+)
+
+var (
+	//id of this server instance, own messages coming back from redis are skipped by it
+	chatInstanceID = newChatInstanceID()
+
+	chatConnectionSeq atomic.Uint64
+	chatBackplaneOn   atomic.Bool
+)
+
+// message of room sent to other instances
+type chatEnvelope struct {
+	Origin  string  `json:"origin"`
+	RoomID  string  `json:"roomID"`
+	Message Message `json:"message"`
+}
+
+func newChatInstanceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+func getChatChannel(roomID string) string {
+	return ChatChannelPrefix + roomID
+}
+
+// sorted set of connections in room, score is last heartbeat of their instance
+func getChatMembersKey(roomID string) string {
+	return fmt.Sprintf("%s%s:members", ChatChannelPrefix, roomID)
+}
+
+// member entry of connection, uniqueID goes first so online users can be read back
+func newChatMemberID(userID string) string {
+	return fmt.Sprintf("%s@%s#%d", userID, chatInstanceID, chatConnectionSeq.Add(1))
+}
+
+// backplane is on unless CHAT_BACKPLANE=local, then every instance has only its own rooms
+func chatBackplaneEnabled() bool {
+	return os.Getenv("CHAT_BACKPLANE") != "local"
+}
+
+// send message to other instances, failure leaves only local delivery
+func publishChatMessage(roomID string, msg Message) {
+	if !chatBackplaneOn.Load() {
+		return
+	}
+	data, err := json.Marshal(chatEnvelope{Origin: chatInstanceID, RoomID: roomID, Message: msg})
+	if err != nil {
+		return
+	}
+	if err := initializers.RedisClient.Publish(initializers.Ctx, getChatChannel(roomID), data).Err(); err != nil {
+		log.Printf("Failed to publish message of room %s: %v", roomID, err)
+	}
+}
+
+func joinChatRoom(roomID string, memberID string) {
+	if !chatBackplaneOn.Load() {
+		return
+	}
+	key := getChatMembersKey(roomID)
+	pipe := initializers.RedisClient.TxPipeline()
+	pipe.ZAdd(initializers.Ctx, key, redis.Z{Score: float64(time.Now().Unix()), Member: memberID})
+	pipe.Expire(initializers.Ctx, key, 2*ChatMembersTTL)
+	if _, err := pipe.Exec(initializers.Ctx); err != nil {
+		log.Printf("Failed to join room %s in redis: %v", roomID, err)
+	}
+}
+
+func leaveChatRoom(roomID string, memberID string) {
+	if !chatBackplaneOn.Load() {
+		return
+	}
+	if err := initializers.RedisClient.ZRem(initializers.Ctx, getChatMembersKey(roomID), memberID).Err(); err != nil {
+		log.Printf("Failed to leave room %s in redis: %v", roomID, err)
+	}
+}
+
+// oldest heartbeat score of member which is still online
+func chatMembersFreshScore() string {
+	return strconv.FormatInt(time.Now().Add(-ChatMembersTTL).Unix(), 10)
+}
+
+// users connected to room on any instance, local connections only if redis is not used.
+// members of instance which stopped heartbeats(crashed) are skipped, heartbeat removes them
+func chatRoomOnline(roomID string) map[string]bool {
+	online := make(map[string]bool)
+
+	if chatBackplaneOn.Load() {
+		members, err := initializers.RedisClient.ZRangeByScore(initializers.Ctx, getChatMembersKey(roomID), &redis.ZRangeBy{
+			Min: chatMembersFreshScore(),
+			Max: "+inf",
+		}).Result()
+		if err == nil {
+			for _, member := range members {
+				userID, _, _ := strings.Cut(member, "@")
+				online[userID] = true
+			}
+			return online
+		}
+		log.Printf("Failed to read members of room %s: %v", roomID, err)
+	}
+
+	if room := chatHub.existingRoom(roomID); room != nil {
+		room.mx.Lock()
+		for conn := range room.connections {
+			online[conn.id] = true
+		}
+		room.mx.Unlock()
+	}
+	return online
+}
+
+// refresh membership of local connections, so other instances see them online
+func heartbeatChatMembers() {
+	now := float64(time.Now().Unix())
+	pipe := initializers.RedisClient.Pipeline()
+
+	for _, room := range chatHub.allRooms() {
+		room.mx.Lock()
+		key := getChatMembersKey(room.id)
+		for conn := range room.connections {
+			pipe.ZAdd(initializers.Ctx, key, redis.Z{Score: now, Member: conn.memberID})
+		}
+		if len(room.connections) > 0 {
+			pipe.Expire(initializers.Ctx, key, 2*ChatMembersTTL)
+		}
+		room.mx.Unlock()
+	}
+
+	if pipe.Len() == 0 {
+		return
+	}
+	if _, err := pipe.Exec(initializers.Ctx); err != nil {
+		log.Printf("Failed to refresh chat members: %v", err)
+	}
+}
+
+// drop members of instances which stopped heartbeats(crashed) from every room,
+// also from rooms which have no connections on this instance
+func removeStaleChatMembers() {
+	stale := "(" + chatMembersFreshScore()
+
+	iter := initializers.RedisClient.Scan(initializers.Ctx, 0, ChatChannelPrefix+"*:members", 100).Iterator()
+	for iter.Next(initializers.Ctx) {
+		if err := initializers.RedisClient.ZRemRangeByScore(initializers.Ctx, iter.Val(), "-inf", stale).Err(); err != nil {
+			log.Printf("Failed to remove stale members of %s: %v", iter.Val(), err)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("Failed to scan chat rooms members: %v", err)
+	}
+}
+
+// pass messages of other instances to local rooms, rooms without local connections are skipped
+func receiveChatMessages(pubsub *redis.PubSub) {
+	for redisMsg := range pubsub.Channel() {
+		var envelope chatEnvelope
+		if err := json.Unmarshal([]byte(redisMsg.Payload), &envelope); err != nil {
+			log.Printf("Failed to read message from redis channel %s: %v", redisMsg.Channel, err)
+			continue
+		}
+		if envelope.Origin == chatInstanceID {
+			continue
+		}
+
+		if room := chatHub.existingRoom(envelope.RoomID); room != nil {
+			room.deliver(envelope.Message)
+		}
+	}
+}
+
+func StartChatBackplane() {
+	if !chatBackplaneEnabled() {
+		log.Println("Chat backplane is off, rooms are local to this instance")
+		return
+	}
+
+	pubsub := initializers.RedisClient.PSubscribe(initializers.Ctx, ChatChannelPrefix+"*")
+	if _, err := pubsub.Receive(initializers.Ctx); err != nil {
+		log.Printf("Cant subscribe to chat channels, rooms are local to this instance: %v", err)
+		pubsub.Close()
+		return
+	}
+	chatBackplaneOn.Store(true)
+	log.Printf("Chat backplane started, instance %s", chatInstanceID)
+
+	go receiveChatMessages(pubsub)
+
+	go func() {
+		ticker := time.NewTicker(ChatHeartbeatInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			heartbeatChatMembers()
+			removeStaleChatMembers()
+		}
+	}()
+}
@@ -5,19 +5,39 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"server/initializers"
 	"server/models"
+	"server/utils"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-// message format
+const (
+	ChatHistoryDefaultSize = 50
+	ChatHistoryMaxSize     = 200
+
+	//undelivered messages sent on connect, they must fit into send buffer. older ones are in history
+	ChatPendingDeliveryMax = 200
+)
+
+// message format, ID and Timestamp are set when message is saved
 type Message struct {
-	SenderID   string `json:"senderID"`
-	ReceiverID string `json:"receiverID"`
-	Body       string `json:"body"`
+	ID         uint       `json:"id,omitempty"`
+	SenderID   string     `json:"senderID"`
+	ReceiverID string     `json:"receiverID"`
+	Body       string     `json:"body"`
+	Timestamp  *time.Time `json:"timestamp,omitempty"`
+}
+
+// position of oldest message on a history page, older ones come next
+type chatCursor struct {
+	ID uint `json:"i"`
 }
 
 // Connection with ws
@@ -26,6 +46,16 @@ type Connection struct {
 	send chan Message
 	room *Room
 	id   string //uniqueID
+
+	memberID string //entry of connection in room members kept in redis
+
+	lastPushed uint //newest undelivered message sent on connect, room skips it and older ones
+	closeOnce  sync.Once
+
+	//registered, but messages which came while user was away are still loading. room keeps new ones in held,
+	//they are sent after loaded ones. both fields are guarded by room.mx
+	joining bool
+	held    []Message
 }
 
 // chat room
@@ -57,7 +87,7 @@ func (h *Hub) getRoom(roomID string) *Room {
 	r := &Room{
 		id:          roomID,
 		connections: make(map[*Connection]bool),
-		broadcast:   make(chan Message),
+		broadcast:   make(chan Message, 64),
 		done:        make(chan bool),
 	}
 	h.rooms[roomID] = r
@@ -65,6 +95,42 @@ func (h *Hub) getRoom(roomID string) *Room {
 	return r
 }
 
+// room with local connections, nil if nobody is connected to it on this instance
+func (h *Hub) existingRoom(roomID string) *Room {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	return h.rooms[roomID]
+}
+
+func (h *Hub) allRooms() []*Room {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	rooms := make([]*Room, 0, len(h.rooms))
+	for _, r := range h.rooms {
+		rooms = append(rooms, r)
+	}
+	return rooms
+}
+
+// pass message to local connections, false if room is overloaded and message is dropped
+func (r *Room) deliver(msg Message) bool {
+	select {
+	case r.broadcast <- msg:
+		return true
+	default:
+		log.Printf("Room %s broadcast channel is full, dropping message %d", r.id, msg.ID)
+		return false
+	}
+}
+
+// send message of local sender to room on every instance
+func (r *Room) publish(msg Message) bool {
+	publishChatMessage(r.id, msg)
+	return r.deliver(msg)
+}
+
 // room goroutine which broadcasts messages
 func (r *Room) run() {
 	for {
@@ -72,15 +138,34 @@ func (r *Room) run() {
 		case msg := <-r.broadcast:
 			r.mx.Lock()
 			log.Printf("Broadcasting message in room %s: %+v", r.id, msg)
+			delivered := false
 			for c := range r.connections {
+				if msg.ID != 0 && msg.ID <= c.lastPushed {
+					continue
+				}
+				if c.joining {
+					c.held = append(c.held, msg)
+					if c.id == msg.ReceiverID {
+						delivered = true
+					}
+					continue
+				}
 				select {
 				case c.send <- msg:
+					if c.id == msg.ReceiverID {
+						delivered = true
+					}
 				default:
-					close(c.send)
 					delete(r.connections, c)
+					c.closeSend()
 				}
 			}
 			r.mx.Unlock()
+
+			//receiver got it, otherwise message waits in db until he connects
+			if delivered && msg.ID != 0 {
+				go markChatMessageDelivered(msg.ID)
+			}
 		case <-r.done:
 			return
 		}
@@ -93,6 +178,145 @@ func generateRoomID(a, b string) string {
 	return fmt.Sprintf("%s:%s", ids[0], ids[1])
 }
 
+// other participant of room, uniqueIDs have no ':' so room id splits back
+func roomPeerID(roomID string, id string) string {
+	ids := strings.SplitN(roomID, ":", 2)
+	if len(ids) != 2 {
+		return ""
+	}
+	if ids[0] == id {
+		return ids[1]
+	}
+	return ids[0]
+}
+
+func chatMessageFromModel(model models.ChatMessageModel) Message {
+	createdAt := model.CreatedAt
+	return Message{
+		ID:         model.ID,
+		SenderID:   model.SenderID,
+		ReceiverID: model.ReceiverID,
+		Body:       model.Body,
+		Timestamp:  &createdAt,
+	}
+}
+
+func markChatMessageDelivered(id uint) {
+	err := initializers.DB.Model(&models.ChatMessageModel{}).
+		Where("id = ? AND delivered_at IS NULL", id).
+		Update("delivered_at", time.Now()).Error
+	if err != nil {
+		log.Printf("Failed to mark chat message %d delivered: %v", id, err)
+	}
+}
+
+// newest messages to user which were sent while he was offline, oldest first.
+// all older ones are marked delivered too, client loads them from history
+func pendingChatMessages(roomID string, receiverID string) []Message {
+	var rows []models.ChatMessageModel
+	if err := initializers.DB.
+		Where("room_id = ? AND receiver_id = ? AND delivered_at IS NULL", roomID, receiverID).
+		Order("id desc").
+		Limit(ChatPendingDeliveryMax).
+		Find(&rows).Error; err != nil {
+		log.Printf("Failed to load undelivered messages of user %s: %v", receiverID, err)
+		return nil
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	err := initializers.DB.Model(&models.ChatMessageModel{}).
+		Where("room_id = ? AND receiver_id = ? AND delivered_at IS NULL AND id <= ?", roomID, receiverID, rows[0].ID).
+		Update("delivered_at", time.Now()).Error
+	if err != nil {
+		log.Printf("Failed to mark undelivered messages of user %s: %v", receiverID, err)
+		return nil
+	}
+
+	messages := make([]Message, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		messages = append(messages, chatMessageFromModel(rows[i]))
+	}
+	return messages
+}
+
+// store message before it is broadcast, so conversation outlives connections
+func saveChatMessage(roomID string, msg Message) (Message, error) {
+	model := models.ChatMessageModel{
+		RoomID:     roomID,
+		SenderID:   msg.SenderID,
+		ReceiverID: msg.ReceiverID,
+		Body:       msg.Body,
+	}
+	if err := initializers.DB.Create(&model).Error; err != nil {
+		return msg, err
+	}
+	return chatMessageFromModel(model), nil
+}
+
+// messages of conversation with ?chatWithID=<uniqueID>, newest page first.
+// messages of page go from old to new, nextCursor loads older ones
+func GetChatHistory(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	chatWithID := c.Query("chatWithID")
+	if chatWithID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chatWithID is required"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(ChatHistoryDefaultSize)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong page size!"})
+		return
+	}
+	if limit > ChatHistoryMaxSize {
+		limit = ChatHistoryMaxSize
+	}
+
+	roomID := generateRoomID(currentUser.UniqueID, chatWithID)
+	query := initializers.DB.Where("room_id = ?", roomID)
+	if cursor := c.Query("cursor"); cursor != "" {
+		var position chatCursor
+		if err := utils.DecodeCursor(cursor, &position); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong cursor!"})
+			return
+		}
+		query = query.Where("id < ?", position.ID)
+	}
+
+	//one extra message tells if there are older ones
+	var rows []models.ChatMessageModel
+	if err := query.Order("id desc").Limit(limit + 1).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load chat history!"})
+		return
+	}
+
+	nextCursor := ""
+	if len(rows) > limit {
+		rows = rows[:limit]
+		nextCursor = utils.EncodeCursor(chatCursor{ID: rows[len(rows)-1].ID})
+	}
+
+	messages := make([]Message, 0, len(rows))
+	for i := len(rows) - 1; i >= 0; i-- {
+		messages = append(messages, chatMessageFromModel(rows[i]))
+	}
+
+	//read position of current user, messages after it are unread
+	var read models.ChatReadModel
+	initializers.DB.Where("room_id = ? AND user_id = ?", roomID, currentUser.UniqueID).Limit(1).Find(&read)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":       messages,
+		"nextCursor": nextCursor,
+		"lastReadID": read.LastReadID,
+		"peerOnline": chatRoomOnline(roomID)[chatWithID],
+	})
+}
+
 // ws endpoint
 func ChatSocket(c *gin.Context) {
 	user, exists := c.Get("user")
@@ -140,12 +364,42 @@ func ChatSocket(c *gin.Context) {
 		send: make(chan Message, 256),
 		room: room,
 		id:   userA,
+
+		memberID: newChatMemberID(userA),
 	}
 
+	//connection is registered before messages which came while user was away are loaded, so one saved
+	//in between is not missed, room holds it until loaded ones are sent. db is not queried under room lock
+	conn.joining = true
 	room.mx.Lock()
 	room.connections[conn] = true
 	connectionCount := len(room.connections)
 	room.mx.Unlock()
+	joinChatRoom(roomID, conn.memberID)
+
+	pending := pendingChatMessages(roomID, userA)
+
+	//pumps are not running yet, buffer takes loaded messages. held ones already loaded are skipped
+	room.mx.Lock()
+	for _, msg := range pending {
+		conn.send <- msg
+		conn.lastPushed = msg.ID
+	}
+	for _, msg := range conn.held {
+		if msg.ID != 0 && msg.ID <= conn.lastPushed {
+			continue
+		}
+		if len(conn.send) == cap(conn.send) {
+			//too much came while joining, like in room run slow connection is dropped
+			delete(room.connections, conn)
+			conn.closeSend()
+			break
+		}
+		conn.send <- msg
+	}
+	conn.held = nil
+	conn.joining = false
+	room.mx.Unlock()
 
 	log.Printf("User %s joined room %s. Total connections: %d", userA, roomID, connectionCount)
 
@@ -161,10 +415,11 @@ func (c *Connection) readPump() {
 		delete(c.room.connections, c)
 		connectionCount := len(c.room.connections)
 		c.room.mx.Unlock()
+		leaveChatRoom(c.room.id, c.memberID)
 
 		log.Printf("User %s left room %s. Remaining connections: %d", c.id, c.room.id, connectionCount)
 
-		close(c.send)
+		c.closeSend()
 		c.ws.Close()
 	}()
 
@@ -212,27 +467,52 @@ func (c *Connection) readPump() {
 			continue
 		}
 
+		if msg.ReceiverID != roomPeerID(c.room.id, c.id) {
+			log.Printf("Receiver %s is not in room %s of user %s", msg.ReceiverID, c.room.id, c.id)
+			c.sendErrorMessage("Receiver is not in this chat")
+			continue
+		}
+
 		if msg.Body == "" {
 			log.Printf("Empty message body from user %s", c.id)
 			c.sendErrorMessage("Message body cannot be empty")
 			continue
 		}
 
-		select {
-		case c.room.broadcast <- msg:
+		saved, err := saveChatMessage(c.room.id, msg)
+		if err != nil {
+			log.Printf("Failed to save message from user %s: %v", c.id, err)
+			c.sendErrorMessage("Failed to save message")
+			continue
+		}
+		msg = saved
+
+		if c.room.publish(msg) {
 			log.Printf("Message from %s successfully sent to broadcast", c.id)
-		default:
-			log.Printf("Room broadcast channel is full, dropping message from %s", c.id)
 		}
 	}
 }
 
+// room closes send of slow connection and read loop closes it on exit, whichever is first
+func (c *Connection) closeSend() {
+	c.closeOnce.Do(func() {
+		close(c.send)
+	})
+}
+
 func (c *Connection) sendErrorMessage(errorText string) {
 	errorMsg := Message{
 		SenderID:   "system",
 		ReceiverID: c.id,
 		Body:       errorText,
 	}
+
+	//connection dropped by room has its send closed already
+	c.room.mx.Lock()
+	defer c.room.mx.Unlock()
+	if !c.room.connections[c] {
+		return
+	}
 	select {
 	case c.send <- errorMsg:
 	default:
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"server/initializers"
+	"server/models"
+)
+
+// unread messages of one conversation
+type chatUnread struct {
+	ChatWithID    string `json:"chatWithID"`
+	Unread        int64  `json:"unread"`
+	LastReadID    uint   `json:"lastReadID"`
+	LastMessageID uint   `json:"lastMessageID"`
+}
+
+// conversations of user with messages to him after his last read position
+func chatUnreadCounts(userID string) ([]chatUnread, int64, error) {
+	var rows []struct {
+		RoomID        string
+		Unread        int64
+		LastReadID    uint
+		LastMessageID uint
+	}
+	err := initializers.DB.Model(&models.ChatMessageModel{}).
+		Select("chat_message_models.room_id, COUNT(*) AS unread, "+
+			"COALESCE(MAX(chat_read_models.last_read_id), 0) AS last_read_id, MAX(chat_message_models.id) AS last_message_id").
+		Joins("LEFT JOIN chat_read_models ON chat_read_models.room_id = chat_message_models.room_id AND chat_read_models.user_id = ?", userID).
+		Where("chat_message_models.receiver_id = ? AND chat_message_models.id > COALESCE(chat_read_models.last_read_id, 0)", userID).
+		Group("chat_message_models.room_id").
+		Order("last_message_id desc").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	conversations := make([]chatUnread, 0, len(rows))
+	var total int64
+	for _, row := range rows {
+		conversations = append(conversations, chatUnread{
+			ChatWithID:    roomPeerID(row.RoomID, userID),
+			Unread:        row.Unread,
+			LastReadID:    row.LastReadID,
+			LastMessageID: row.LastMessageID,
+		})
+		total += row.Unread
+	}
+	return conversations, total, nil
+}
+
+// total for header badge and unread count of every conversation, newest first
+func GetChatUnread(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	conversations, total, err := chatUnreadCounts(currentUser.UniqueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant count unread messages!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"total": total, "conversations": conversations})
+}
+
+// move read position of conversation forward, without messageID everything is read
+func MarkChatRead(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var input struct {
+		ChatWithID string `json:"chatWithID" binding:"required"`
+		MessageID  *uint  `json:"messageID"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	roomID := generateRoomID(currentUser.UniqueID, input.ChatWithID)
+
+	var lastID uint
+	query := initializers.DB.Model(&models.ChatMessageModel{}).Where("room_id = ?", roomID)
+	if input.MessageID != nil {
+		query = query.Where("id <= ?", *input.MessageID)
+	}
+	if err := query.Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant mark messages read!"})
+		return
+	}
+
+	//position only moves forward, read receipt from older tab changes nothing
+	read := models.ChatReadModel{RoomID: roomID, UserID: currentUser.UniqueID}
+	if err := initializers.DB.Where(read).Attrs(models.ChatReadModel{LastReadID: lastID}).FirstOrCreate(&read).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant mark messages read!"})
+		return
+	}
+	if read.LastReadID < lastID {
+		if err := initializers.DB.Model(&read).Where("last_read_id < ?", lastID).Update("last_read_id", lastID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant mark messages read!"})
+			return
+		}
+		read.LastReadID = lastID
+	}
+
+	_, total, err := chatUnreadCounts(currentUser.UniqueID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant count unread messages!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"lastReadID": read.LastReadID, "total": total})
+}
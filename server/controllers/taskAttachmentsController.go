@@ -0,0 +1,302 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/storage"
+	"server/utils"
+	"strconv"
+	"time"
+)
+
+// bytes read from upload to detect its type
+const attachmentSniffSize = 512
+
+type taskAttachmentResponse struct {
+	ID           uint      `json:"id"`
+	FileName     string    `json:"fileName"`
+	ContentType  string    `json:"contentType"`
+	Size         int64     `json:"size"`
+	Uploader     gin.H     `json:"uploader"`
+	CreatedAt    time.Time `json:"createdAt"`
+	URL          string    `json:"url"`
+	URLExpiresAt time.Time `json:"urlExpiresAt"`
+}
+
+func attachmentResponse(attachment models.TaskAttachmentModel, uploader models.User) taskAttachmentResponse {
+	url, expiresAt := utils.SignAttachmentURL(attachment.ID)
+	return taskAttachmentResponse{
+		ID:           attachment.ID,
+		FileName:     attachment.FileName,
+		ContentType:  attachment.ContentType,
+		Size:         attachment.Size,
+		Uploader:     shareUserInfo(uploader),
+		CreatedAt:    attachment.CreatedAt,
+		URL:          url,
+		URLExpiresAt: expiresAt,
+	}
+}
+
+// random key, file name of user is never part of it
+func newAttachmentKey(ownerID uint) string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("tasks/%d/%s", ownerID, hex.EncodeToString(b))
+}
+
+// file name safe for db column, long names are cut by runes
+func attachmentFileName(name string) string {
+	runes := []rune(name)
+	if len(runes) > 255 {
+		runes = runes[:255]
+	}
+	if len(runes) == 0 {
+		return "file"
+	}
+	return string(runes)
+}
+
+// remove files from store after their rows are deleted, failures are only logged
+// because rows are already gone and nobody can reach the files
+func deleteAttachmentFiles(store storage.Storage, attachments []models.TaskAttachmentModel) {
+	for _, attachment := range attachments {
+		if err := store.Delete(context.Background(), attachment.StorageKey); err != nil {
+			log.Printf("Failed to delete attachment file %s: %v", attachment.StorageKey, err)
+		}
+	}
+}
+
+// find attachment from url param, its task must be in the list and not in trash
+func findTaskAttachment(c *gin.Context, ownerID uint) (models.TaskAttachmentModel, bool) {
+	var attachment models.TaskAttachmentModel
+
+	attachmentID, err := strconv.Atoi(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong attachment id!"})
+		return attachment, false
+	}
+
+	if err := initializers.DB.
+		Joins("JOIN tasks_models ON tasks_models.id = task_attachment_models.task_id").
+		Where("task_attachment_models.id = ? AND tasks_models.user_id = ? AND tasks_models.deleted_at IS NULL", attachmentID, ownerID).
+		First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found!"})
+		return attachment, false
+	}
+
+	return attachment, true
+}
+
+// stream file from storage as download
+func serveAttachment(c *gin.Context, attachment models.TaskAttachmentModel) {
+	file, err := initializers.Storage.Get(c.Request.Context(), attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Attachment file is missing!"})
+			return
+		}
+		log.Printf("Failed to read attachment %d: %v", attachment.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load attachment!"})
+		return
+	}
+	defer file.Close()
+
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, file, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=0",
+	})
+}
+
+func GetTaskAttachments(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var attachments []models.TaskAttachmentModel
+	if err := initializers.DB.Where("task_id = ?", task.ID).Order("id asc").Find(&attachments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load attachments!"})
+		return
+	}
+
+	var uploaderIDs []uint
+	for _, attachment := range attachments {
+		uploaderIDs = append(uploaderIDs, attachment.UploaderID)
+	}
+	uploaders, err := usersByID(uploaderIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load attachments!"})
+		return
+	}
+
+	response := []taskAttachmentResponse{}
+	for _, attachment := range attachments {
+		response = append(response, attachmentResponse(attachment, uploaders[attachment.UploaderID]))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+// upload file in multipart "file" field, size, type and quota are checked before storing
+func UploadTaskAttachment(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	maxSize := utils.AttachmentMaxSize()
+	maxSizeMessage := "File is too large, max is " + strconv.FormatInt(maxSize>>20, 10) + " MB!"
+
+	//some room for multipart headers
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": maxSizeMessage})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send file in \"file\" field!"})
+		return
+	}
+
+	if fileHeader.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": maxSizeMessage})
+		return
+	}
+
+	var used int64
+	if err := initializers.DB.Model(&models.TaskAttachmentModel{}).
+		Where("user_id = ?", ownerID).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&used).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant upload attachment!"})
+		return
+	}
+	if used+fileHeader.Size > utils.AttachmentsQuota() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Attachments storage is full, delete some files first!"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cant read uploaded file!"})
+		return
+	}
+	defer file.Close()
+
+	//type comes from content, not from name or header of client
+	head := make([]byte, attachmentSniffSize)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cant read uploaded file!"})
+		return
+	}
+	head = head[:n]
+
+	contentType := utils.AttachmentContentType(http.DetectContentType(head))
+	if contentType == "" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only images, PDF, text and zip files can be attached!"})
+		return
+	}
+
+	attachment := models.TaskAttachmentModel{
+		TaskID:      task.ID,
+		UserID:      ownerID,
+		UploaderID:  currentUser.ID,
+		FileName:    attachmentFileName(fileHeader.Filename),
+		ContentType: contentType,
+		Size:        fileHeader.Size,
+		StorageKey:  newAttachmentKey(ownerID),
+	}
+
+	body := io.MultiReader(bytes.NewReader(head), file)
+	if err := initializers.Storage.Put(c.Request.Context(), attachment.StorageKey, body, attachment.Size, contentType); err != nil {
+		log.Printf("Failed to store attachment for task %d: %v", task.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant upload attachment!"})
+		return
+	}
+
+	if err := initializers.DB.Create(&attachment).Error; err != nil {
+		deleteAttachmentFiles(initializers.Storage, []models.TaskAttachmentModel{attachment})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant upload attachment!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": attachmentResponse(attachment, currentUser)})
+}
+
+// download for user with access to task list
+func DownloadTaskAttachment(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	attachment, ok := findTaskAttachment(c, ownerID)
+	if !ok {
+		return
+	}
+
+	serveAttachment(c, attachment)
+}
+
+// download by signed url, it is given only to users with access to the list
+func DownloadSignedAttachment(c *gin.Context) {
+	attachmentID, err := strconv.Atoi(c.Param("attachmentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong attachment id!"})
+		return
+	}
+
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	if err != nil || !utils.IsValidAttachmentSignature(uint(attachmentID), expires, c.Query("signature")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Link is invalid or expired!"})
+		return
+	}
+
+	var attachment models.TaskAttachmentModel
+	if err := initializers.DB.
+		Joins("JOIN tasks_models ON tasks_models.id = task_attachment_models.task_id").
+		Where("task_attachment_models.id = ? AND tasks_models.deleted_at IS NULL", attachmentID).
+		First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found!"})
+		return
+	}
+
+	serveAttachment(c, attachment)
+}
+
+func DeleteTaskAttachment(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	attachment, ok := findTaskAttachment(c, ownerID)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Unscoped().Delete(&attachment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete attachment!"})
+		return
+	}
+
+	deleteAttachmentFiles(initializers.Storage, []models.TaskAttachmentModel{attachment})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted!"})
+}
@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"time"
+)
+
+type taskCommentResponse struct {
+	ID        uint       `json:"id"`
+	ParentID  *uint      `json:"parentId"`
+	Body      string     `json:"body"`
+	Author    gin.H      `json:"author"`
+	CreatedAt time.Time  `json:"createdAt"`
+	EditedAt  *time.Time `json:"editedAt"`
+	Deleted   bool       `json:"deleted"`
+}
+
+// fill CommentCount of listed tasks with one grouped query
+func attachCommentCounts(tasks []models.TasksModel) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+
+	var counts []struct {
+		TaskID uint
+		Count  int64
+	}
+	if err := initializers.DB.Model(&models.TaskCommentModel{}).
+		Select("task_id, COUNT(*) AS count").
+		Where("task_id IN ?", ids).
+		Group("task_id").
+		Scan(&counts).Error; err != nil {
+		return err
+	}
+
+	byTask := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		byTask[count.TaskID] = count.Count
+	}
+	for i := range tasks {
+		tasks[i].CommentCount = byTask[tasks[i].ID]
+	}
+	return nil
+}
+
+// find task of list from url param
+func findListTask(c *gin.Context, ownerID uint) (models.TasksModel, bool) {
+	var task models.TasksModel
+
+	localTaskID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong task id!"})
+		return task, false
+	}
+
+	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, ownerID).First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task!"})
+		return task, false
+	}
+
+	return task, true
+}
+
+// find comment from url param, it must belong to a task of the list
+func findTaskComment(c *gin.Context, ownerID uint) (models.TaskCommentModel, bool) {
+	var comment models.TaskCommentModel
+
+	commentID, err := strconv.Atoi(c.Param("commentId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong comment id!"})
+		return comment, false
+	}
+
+	if err := initializers.DB.
+		Joins("JOIN tasks_models ON tasks_models.id = task_comment_models.task_id").
+		Where("task_comment_models.id = ? AND tasks_models.user_id = ?", commentID, ownerID).
+		First(&comment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found!"})
+		return comment, false
+	}
+
+	return comment, true
+}
+
+// comments of task in creation order, client builds threads from parentId.
+// deleted comment stays as placeholder while it has replies
+func GetTaskComments(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var comments []models.TaskCommentModel
+	if err := initializers.DB.Unscoped().Where("task_id = ?", task.ID).Order("id asc").Find(&comments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load comments!"})
+		return
+	}
+
+	//replies always have bigger id than parent, so walk from the end
+	hasReplies := make(map[uint]bool)
+	keep := make([]bool, len(comments))
+	for i := len(comments) - 1; i >= 0; i-- {
+		comment := comments[i]
+		keep[i] = !comment.DeletedAt.Valid || hasReplies[comment.ID]
+		if keep[i] && comment.ParentID != nil {
+			hasReplies[*comment.ParentID] = true
+		}
+	}
+
+	var authorIDs []uint
+	for _, comment := range comments {
+		authorIDs = append(authorIDs, comment.AuthorID)
+	}
+	authors, err := usersByID(authorIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load comments!"})
+		return
+	}
+
+	response := []taskCommentResponse{}
+	for i, comment := range comments {
+		if !keep[i] {
+			continue
+		}
+		item := taskCommentResponse{
+			ID:        comment.ID,
+			ParentID:  comment.ParentID,
+			Body:      comment.Body,
+			Author:    shareUserInfo(authors[comment.AuthorID]),
+			CreatedAt: comment.CreatedAt,
+			EditedAt:  comment.EditedAt,
+		}
+		if comment.DeletedAt.Valid {
+			item.Body = ""
+			item.Author = nil
+			item.Deleted = true
+		}
+		response = append(response, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+func CreateTaskComment(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body     string `json:"body" binding:"required"`
+		ParentID *uint  `json:"parentId"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !utils.IsValidComment(input.Body) {
+		c.JSON(http.StatusBadRequest, gin.H{"commentError": "Comment must be between 1 and 2000 characters!"})
+		return
+	}
+
+	//reply must be in the same task thread
+	if input.ParentID != nil {
+		var count int64
+		initializers.DB.Model(&models.TaskCommentModel{}).
+			Where("id = ? AND task_id = ?", *input.ParentID, task.ID).
+			Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Parent comment not found!"})
+			return
+		}
+	}
+
+	comment := models.TaskCommentModel{
+		TaskID:   task.ID,
+		AuthorID: currentUser.ID,
+		ParentID: input.ParentID,
+		Body:     input.Body,
+	}
+
+	if err := initializers.DB.Create(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant create comment!"})
+		return
+	}
+
+	//comment count is part of cached tasks list
+	invalidateUserTaskCaches(ownerID)
+
+	c.JSON(http.StatusOK, gin.H{"data": taskCommentResponse{
+		ID:        comment.ID,
+		ParentID:  comment.ParentID,
+		Body:      comment.Body,
+		Author:    shareUserInfo(currentUser),
+		CreatedAt: comment.CreatedAt,
+	}})
+}
+
+// only author can edit his comment
+func UpdateTaskComment(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
+
+	comment, ok := findTaskComment(c, ownerID)
+	if !ok {
+		return
+	}
+
+	if comment.AuthorID != currentUser.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can edit only your comments!"})
+		return
+	}
+
+	var input struct {
+		Body string `json:"body" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !utils.IsValidComment(input.Body) {
+		c.JSON(http.StatusBadRequest, gin.H{"commentError": "Comment must be between 1 and 2000 characters!"})
+		return
+	}
+
+	now := time.Now()
+	comment.Body = input.Body
+	comment.EditedAt = &now
+
+	if err := initializers.DB.Save(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant update comment!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": taskCommentResponse{
+		ID:        comment.ID,
+		ParentID:  comment.ParentID,
+		Body:      comment.Body,
+		Author:    shareUserInfo(currentUser),
+		CreatedAt: comment.CreatedAt,
+		EditedAt:  comment.EditedAt,
+	}})
+}
+
+// author or owner of the list can delete comment
+func DeleteTaskComment(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
+
+	comment, ok := findTaskComment(c, ownerID)
+	if !ok {
+		return
+	}
+
+	if comment.AuthorID != currentUser.ID && ownerID != currentUser.ID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can delete only your comments!"})
+		return
+	}
+
+	if err := initializers.DB.Delete(&comment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete comment!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Comment deleted!"})
+}
@@ -0,0 +1,305 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"strconv"
+	"time"
+)
+
+const TaskDependencyMaxCount = 50
+
+var (
+	errTaskDependencyCycle = errors.New("dependency cycle")
+	errTaskDependencyLimit = errors.New("too many dependencies")
+)
+
+// condition which keeps only tasks without open blockers, use with tasks_models query
+const actionableTaskCondition = "NOT EXISTS (SELECT 1 FROM task_dependency_models " +
+	"JOIN tasks_models AS blockers ON blockers.id = task_dependency_models.blocked_by_id " +
+	"WHERE task_dependency_models.task_id = tasks_models.id AND blockers.completed = ? AND blockers.deleted_at IS NULL)"
+
+// fill BlockedBy and Blocked of loaded tasks, blockers in trash do not block
+func attachTaskDependencies(tasks []models.TasksModel) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+
+	var rows []struct {
+		TaskID    uint
+		LocalID   uint
+		Completed bool
+	}
+	if err := initializers.DB.Model(&models.TaskDependencyModel{}).
+		Select("task_dependency_models.task_id, blockers.local_id, blockers.completed").
+		Joins("JOIN tasks_models AS blockers ON blockers.id = task_dependency_models.blocked_by_id AND blockers.deleted_at IS NULL").
+		Where("task_dependency_models.task_id IN ?", ids).
+		Order("blockers.local_id asc").
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+
+	blockedBy := make(map[uint][]uint)
+	blocked := make(map[uint]bool)
+	for _, row := range rows {
+		blockedBy[row.TaskID] = append(blockedBy[row.TaskID], row.LocalID)
+		if !row.Completed {
+			blocked[row.TaskID] = true
+		}
+	}
+	for i := range tasks {
+		tasks[i].BlockedBy = blockedBy[tasks[i].ID]
+		if tasks[i].BlockedBy == nil {
+			tasks[i].BlockedBy = []uint{}
+		}
+		tasks[i].Blocked = blocked[tasks[i].ID]
+	}
+	return nil
+}
+
+// true if blocker already waits for task, directly or through other tasks
+func dependencyCreatesCycle(tx *gorm.DB, ownerID uint, taskID uint, blockerID uint) (bool, error) {
+	var dependencies []models.TaskDependencyModel
+	if err := tx.Where("user_id = ?", ownerID).Find(&dependencies).Error; err != nil {
+		return false, err
+	}
+
+	blockersOf := make(map[uint][]uint)
+	for _, dependency := range dependencies {
+		blockersOf[dependency.TaskID] = append(blockersOf[dependency.TaskID], dependency.BlockedByID)
+	}
+
+	//walk from blocker through its blockers, reaching task means a loop
+	visited := map[uint]bool{blockerID: true}
+	queue := []uint{blockerID}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == taskID {
+			return true, nil
+		}
+		for _, next := range blockersOf[current] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false, nil
+}
+
+// dependents which waited for given tasks, their Blocked flag may be changed now
+func dependentTasks(ownerID uint, blockerIDs ...uint) ([]models.TasksModel, error) {
+	var tasks []models.TasksModel
+	if len(blockerIDs) == 0 {
+		return tasks, nil
+	}
+	if err := initializers.DB.
+		Where("user_id = ? AND id IN (?)", ownerID,
+			initializers.DB.Model(&models.TaskDependencyModel{}).Select("task_id").Where("blocked_by_id IN ?", blockerIDs)).
+		Order("`order` asc, id asc").
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, attachTaskDependencies(tasks)
+}
+
+// move updated_at of tasks which wait for blockers, so delta sync sends their new Blocked state.
+// version stays, content of dependents did not change and clients editing them must not get a conflict.
+// call in the same transaction which completes, trashes or restores blockers
+func touchDependents(tx *gorm.DB, blockerIDs ...uint) error {
+	if len(blockerIDs) == 0 {
+		return nil
+	}
+	return tx.Model(&models.TasksModel{}).
+		Where("id IN (?)", tx.Model(&models.TaskDependencyModel{}).Select("task_id").Where("blocked_by_id IN ?", blockerIDs)).
+		UpdateColumn("updated_at", time.Now()).Error
+}
+
+// send dependents of changed blockers to open sessions, so they see them unblocked
+func broadcastDependents(c *gin.Context, ownerID uint, blockerIDs ...uint) []models.TasksModel {
+	dependents, err := dependentTasks(ownerID, blockerIDs...)
+	if err != nil {
+		return nil
+	}
+	broadcastTaskEvent(c, ownerID, TaskEventUpdated, dependents)
+	return dependents
+}
+
+// bump version of task whose dependencies changed, so sync and other sessions see it
+func touchTask(tx *gorm.DB, task *models.TasksModel) error {
+	if err := tx.Model(task).Update("version", gorm.Expr("version + 1")).Error; err != nil {
+		return err
+	}
+	return tx.First(task, task.ID).Error
+}
+
+// tasks which block task and tasks which wait for it
+func GetTaskDependencies(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var blockedBy []models.TasksModel
+	if err := initializers.DB.
+		Where("id IN (?)", initializers.DB.Model(&models.TaskDependencyModel{}).Select("blocked_by_id").Where("task_id = ?", task.ID)).
+		Order("`order` asc, id asc").
+		Find(&blockedBy).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task dependencies!"})
+		return
+	}
+
+	blocking, err := dependentTasks(ownerID, task.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task dependencies!"})
+		return
+	}
+
+	if err := attachTaskDependencies(blockedBy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task dependencies!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"blockedBy": blockedBy, "blocking": blocking})
+}
+
+// make task wait for another task of the same list
+func AddTaskDependency(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		BlockedBy uint `json:"blockedBy" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.BlockedBy == task.LocalID {
+		c.JSON(http.StatusBadRequest, gin.H{"dependencyError": "Task cant block itself!"})
+		return
+	}
+
+	var blocker models.TasksModel
+	if err := initializers.DB.Where("local_id = ? AND user_id = ?", input.BlockedBy, ownerID).First(&blocker).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a blocking task!"})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.TaskDependencyModel{}).Where("task_id = ?", task.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= TaskDependencyMaxCount {
+			return errTaskDependencyLimit
+		}
+
+		cycle, err := dependencyCreatesCycle(tx, ownerID, task.ID, blocker.ID)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			return errTaskDependencyCycle
+		}
+
+		//adding existing dependency again changes nothing
+		result := tx.Where(models.TaskDependencyModel{TaskID: task.ID, BlockedByID: blocker.ID}).
+			Attrs(models.TaskDependencyModel{UserID: ownerID}).
+			FirstOrCreate(&models.TaskDependencyModel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		return touchTask(tx, &task)
+	})
+	switch {
+	case errors.Is(err, errTaskDependencyCycle):
+		c.JSON(http.StatusConflict, gin.H{"dependencyError": "This would make tasks wait for each other!"})
+		return
+	case errors.Is(err, errTaskDependencyLimit):
+		c.JSON(http.StatusBadRequest, gin.H{"dependencyError": "Task can be blocked by max " + strconv.Itoa(TaskDependencyMaxCount) + " tasks!"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant add dependency!"})
+		return
+	}
+
+	respondTaskDependencyChange(c, ownerID, task)
+}
+
+func DeleteTaskDependency(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	blockerLocalID, err := strconv.Atoi(c.Param("blockerId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong task id!"})
+		return
+	}
+
+	var blocker models.TasksModel
+	if err := initializers.DB.Unscoped().Where("local_id = ? AND user_id = ?", blockerLocalID, ownerID).First(&blocker).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a blocking task!"})
+		return
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("task_id = ? AND blocked_by_id = ?", task.ID, blocker.ID).Delete(&models.TaskDependencyModel{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return touchTask(tx, &task)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dependency not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete dependency!"})
+		return
+	}
+
+	respondTaskDependencyChange(c, ownerID, task)
+}
+
+func respondTaskDependencyChange(c *gin.Context, ownerID uint, task models.TasksModel) {
+	tasks := []models.TasksModel{task}
+	if err := attachTaskDependencies(tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task dependencies!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventUpdated, tasks)
+
+	c.Header("ETag", taskETag(tasks[0]))
+	c.JSON(http.StatusOK, gin.H{"data": tasks[0]})
+}
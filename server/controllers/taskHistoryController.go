@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"strconv"
+	"time"
+)
+
+const (
+	TaskHistoryDefaultLimit = 50
+	TaskHistoryMaxLimit     = 200
+)
+
+// create history entry for a task change
+func newTaskHistory(task models.TasksModel, action models.TaskAction, oldValue string, newValue string) models.TaskHistoryModel {
+	return models.TaskHistoryModel{
+		UserID:      task.UserID,
+		TaskLocalID: task.LocalID,
+		Action:      action,
+		OldValue:    oldValue,
+		NewValue:    newValue,
+	}
+}
+
+func newHistoryGroupID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// save entries as one group, so "undo" reverts them together
+func recordTaskHistory(tx *gorm.DB, entries ...models.TaskHistoryModel) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	groupID := newHistoryGroupID()
+	for i := range entries {
+		entries[i].GroupID = groupID
+	}
+
+	return tx.Create(&entries).Error
+}
+
+// apply the opposite of a history entry and mark it as undone, true if undone reorder renumbered the list
+func revertTaskChange(tx *gorm.DB, entry models.TaskHistoryModel) (models.TasksModel, bool, error) {
+	var task models.TasksModel
+	if err := tx.Unscoped().Where("local_id = ? AND user_id = ?", entry.TaskLocalID, entry.UserID).First(&task).Error; err != nil {
+		return task, false, err
+	}
+
+	//every revert is a new change, so version is bumped like on update
+	values := map[string]interface{}{"version": gorm.Expr("version + 1")}
+
+	var err error
+	var renumbered bool
+	switch entry.Action {
+	case models.TaskActionCreated, models.TaskActionRestored:
+		err = tx.Delete(&task).Error
+		if err == nil {
+			err = touchDependents(tx, task.ID)
+		}
+	case models.TaskActionDeleted:
+		values["deleted_at"] = nil
+		err = touchDependents(tx, task.ID)
+	case models.TaskActionTitleChanged:
+		values["title"] = entry.OldValue
+	case models.TaskActionDescriptionChanged:
+		values["description"] = entry.OldValue
+	case models.TaskActionCompleted, models.TaskActionUncompleted:
+		for key, value := range taskCompletionValues(task, entry.OldValue == "true") {
+			values[key] = value
+		}
+		err = addColumnCompletionUpdate(tx, task, entry.OldValue == "true", values)
+		if err == nil && task.Completed != (entry.OldValue == "true") {
+			err = touchDependents(tx, task.ID)
+		}
+	case models.TaskActionStatusChanged:
+		//completion follows the column, like on a move to it. deleted column takes task off the board
+		values["column_id"] = nil
+		if entry.OldValue != "" {
+			columnID, convErr := strconv.ParseUint(entry.OldValue, 10, 64)
+			if convErr != nil {
+				return task, false, convErr
+			}
+			var column models.TaskColumnModel
+			columnErr := tx.Where("id = ? AND user_id = ?", uint(columnID), task.UserID).First(&column).Error
+			if columnErr != nil && !errors.Is(columnErr, gorm.ErrRecordNotFound) {
+				return task, false, columnErr
+			}
+			if columnErr == nil {
+				values["column_id"] = column.ID
+				for key, value := range taskCompletionValues(task, column.IsDone) {
+					values[key] = value
+				}
+				if task.Completed != column.IsDone {
+					err = touchDependents(tx, task.ID)
+				}
+			}
+		}
+	case models.TaskActionDeferred:
+		values["defer_until"] = nil
+		if entry.OldValue != "" {
+			until, parseErr := time.Parse(time.RFC3339, entry.OldValue)
+			if parseErr != nil {
+				return task, false, parseErr
+			}
+			values["defer_until"] = until
+		}
+	case models.TaskActionTriaged:
+		values["inbox"] = entry.OldValue == "true"
+	case models.TaskActionReordered:
+		order, orderRenumbered, orderErr := restoredTaskOrder(tx, task, entry.OldValue)
+		if orderErr != nil {
+			return task, false, orderErr
+		}
+		renumbered = orderRenumbered
+		values["order"] = order
+	}
+	if err == nil {
+		err = tx.Unscoped().Model(&task).Updates(values).Error
+	}
+	if err != nil {
+		return task, false, err
+	}
+
+	if err := tx.Model(&entry).Update("undone", true).Error; err != nil {
+		return task, false, err
+	}
+
+	//reload to respond with actual state
+	err = tx.Unscoped().First(&task, task.ID).Error
+	return task, renumbered, err
+}
+
+func GetTaskHistory(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	localTaskIDStr := c.Param("id")
+	localTaskID, err := strconv.Atoi(localTaskIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong task id!"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(TaskHistoryDefaultLimit)))
+	if err != nil || limit < 1 {
+		limit = TaskHistoryDefaultLimit
+	}
+	if limit > TaskHistoryMaxLimit {
+		limit = TaskHistoryMaxLimit
+	}
+
+	var history []models.TaskHistoryModel
+	if err := initializers.DB.
+		Where("user_id = ? AND task_local_id = ?", ownerID, localTaskID).
+		Order("id desc").
+		Limit(limit).
+		Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task history!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": history})
+}
+
+// undo the most recent change of one task, all its entries of the same group are reverted together
+func UndoTaskChange(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	localTaskIDStr := c.Param("id")
+	localTaskID, err := strconv.Atoi(localTaskIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong task id!"})
+		return
+	}
+
+	var last models.TaskHistoryModel
+	if err := initializers.DB.
+		Where("user_id = ? AND task_local_id = ? AND undone = ?", ownerID, localTaskID, false).
+		Order("id desc").
+		First(&last).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nothing to undo!"})
+		return
+	}
+
+	//a board move writes column, completion and order as one group, reverting only a part leaves them out of step
+	var entries []models.TaskHistoryModel
+	if err := initializers.DB.
+		Where("user_id = ? AND task_local_id = ? AND group_id = ? AND undone = ?", ownerID, localTaskID, last.GroupID, false).
+		Order("id desc").
+		Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task history!"})
+		return
+	}
+
+	var task models.TasksModel
+	renumbered := false
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		for _, entry := range entries {
+			var entryRenumbered bool
+			var err error
+			if task, entryRenumbered, err = revertTaskChange(tx, entry); err != nil {
+				return err
+			}
+			renumbered = renumbered || entryRenumbered
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task no longer exists!"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant undo task change!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskChanges(c, ownerID, []models.TasksModel{task})
+	broadcastDependents(c, ownerID, task.ID)
+	if renumbered {
+		publishRebalancedOrder(ownerID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": task, "undone": entries})
+}
+
+// undo the most recent change of any task, bulk changes are reverted together
+func UndoLastTaskChange(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var last models.TaskHistoryModel
+	if err := initializers.DB.
+		Where("user_id = ? AND undone = ?", ownerID, false).
+		Order("id desc").
+		First(&last).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nothing to undo!"})
+		return
+	}
+
+	var entries []models.TaskHistoryModel
+	if err := initializers.DB.
+		Where("user_id = ? AND group_id = ? AND undone = ?", ownerID, last.GroupID, false).
+		Order("id desc").
+		Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task history!"})
+		return
+	}
+
+	var tasks []models.TasksModel
+	renumbered := false
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		for _, entry := range entries {
+			task, entryRenumbered, err := revertTaskChange(tx, entry)
+			if err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+			renumbered = renumbered || entryRenumbered
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Task no longer exists!"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant undo task change!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskChanges(c, ownerID, tasks)
+	broadcastDependents(c, ownerID, taskIDs(tasks)...)
+	if renumbered {
+		publishRebalancedOrder(ownerID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tasks, "undone": entries})
+}
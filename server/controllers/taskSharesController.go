@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"server/initializers"
+	"server/middleware"
+	"server/models"
+	"strconv"
+)
+
+// owner of task list which request works with, own or shared
+func taskOwnerID(c *gin.Context) uint {
+	return c.GetUint(middleware.TaskOwnerKey)
+}
+
+func isValidShareRole(role models.TaskRole) bool {
+	return role == models.TaskRoleViewer || role == models.TaskRoleEditor
+}
+
+// public info about the other side of a share
+func shareUserInfo(user models.User) gin.H {
+	return gin.H{
+		"uniqueID": user.UniqueID,
+		"username": user.Username,
+		"avatar":   user.Avatar,
+	}
+}
+
+func shareResponse(share models.TaskShareModel, owner models.User, member models.User) gin.H {
+	return gin.H{
+		"id":        share.ID,
+		"role":      share.Role,
+		"status":    share.Status,
+		"owner":     shareUserInfo(owner),
+		"member":    shareUserInfo(member),
+		"createdAt": share.CreatedAt,
+	}
+}
+
+// load users of shares with one query
+func usersByID(ids []uint) (map[uint]models.User, error) {
+	users := make(map[uint]models.User)
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	var list []models.User
+	if err := initializers.DB.Where("id IN ?", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	for _, u := range list {
+		users[u.ID] = u
+	}
+	return users, nil
+}
+
+// invite another user to own task list by his uniqueID
+func ShareTaskList(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var input struct {
+		UniqueID string          `json:"uniqueID" binding:"required"`
+		Role     models.TaskRole `json:"role"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Role == "" {
+		input.Role = models.TaskRoleViewer
+	}
+	if !isValidShareRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be viewer or editor!"})
+		return
+	}
+
+	if input.UniqueID == currentUser.UniqueID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cant share list with yourself!"})
+		return
+	}
+
+	var member models.User
+	if err := initializers.DB.Where("unique_id = ?", input.UniqueID).First(&member).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found!"})
+		return
+	}
+
+	var share models.TaskShareModel
+	err := initializers.DB.Where("owner_id = ? AND member_id = ?", currentUser.ID, member.ID).First(&share).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant share task list!"})
+		return
+	}
+
+	if err == nil && share.Status != models.ShareStatusDeclined {
+		c.JSON(http.StatusConflict, gin.H{"error": "List is already shared with this user!"})
+		return
+	}
+
+	//declined invitation can be sent again
+	share.OwnerID = currentUser.ID
+	share.MemberID = member.ID
+	share.Role = input.Role
+	share.Status = models.ShareStatusPending
+
+	if err := initializers.DB.Save(&share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant share task list!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": shareResponse(share, currentUser, member)})
+}
+
+// shares of own list, lists shared with current user and his smart lists
+func GetTaskShares(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	var shares []models.TaskShareModel
+	if err := initializers.DB.
+		Where("owner_id = ? OR member_id = ?", currentUser.ID, currentUser.ID).
+		Order("id desc").
+		Find(&shares).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load shares!"})
+		return
+	}
+
+	var ids []uint
+	for _, share := range shares {
+		ids = append(ids, share.OwnerID, share.MemberID)
+	}
+	users, err := usersByID(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load shares!"})
+		return
+	}
+
+	sharedByMe := []gin.H{}
+	sharedWithMe := []gin.H{}
+	invitations := []gin.H{}
+	for _, share := range shares {
+		item := shareResponse(share, users[share.OwnerID], users[share.MemberID])
+		switch {
+		case share.OwnerID == currentUser.ID:
+			sharedByMe = append(sharedByMe, item)
+		case share.Status == models.ShareStatusAccepted:
+			sharedWithMe = append(sharedWithMe, item)
+		case share.Status == models.ShareStatusPending:
+			invitations = append(invitations, item)
+		}
+	}
+
+	//saved queries of own list are listed next to lists shared with user
+	smartLists, err := loadTaskSmartLists(currentUser.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load smart lists!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"sharedByMe":   sharedByMe,
+		"sharedWithMe": sharedWithMe,
+		"invitations":  invitations,
+		"smartLists":   smartLists,
+	})
+}
+
+// find share by url id, where current user is owner or member
+func findShare(c *gin.Context, userID uint, asOwner bool) (models.TaskShareModel, bool) {
+	var share models.TaskShareModel
+
+	shareID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong share id!"})
+		return share, false
+	}
+
+	column := "member_id"
+	if asOwner {
+		column = "owner_id"
+	}
+
+	if err := initializers.DB.Where("id = ? AND "+column+" = ?", shareID, userID).First(&share).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found!"})
+		return share, false
+	}
+
+	return share, true
+}
+
+func UpdateTaskShareRole(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	share, ok := findShare(c, currentUser.ID, true)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role models.TaskRole `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isValidShareRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role must be viewer or editor!"})
+		return
+	}
+
+	share.Role = input.Role
+	if err := initializers.DB.Save(&share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant update share!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share role updated!", "role": share.Role})
+}
+
+// owner revokes access, or member leaves shared list
+func DeleteTaskShare(c *gin.Context) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	shareID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong share id!"})
+		return
+	}
+
+	result := initializers.DB.Unscoped().
+		Where("id = ? AND (owner_id = ? OR member_id = ?)", shareID, currentUser.ID, currentUser.ID).
+		Delete(&models.TaskShareModel{})
+
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete share!"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Share not found!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Share deleted!"})
+}
+
+func AcceptTaskInvitation(c *gin.Context) {
+	respondToTaskInvitation(c, models.ShareStatusAccepted)
+}
+
+func DeclineTaskInvitation(c *gin.Context) {
+	respondToTaskInvitation(c, models.ShareStatusDeclined)
+}
+
+func respondToTaskInvitation(c *gin.Context, status models.ShareStatus) {
+	user, _ := c.Get("user")
+	currentUser := user.(models.User)
+
+	share, ok := findShare(c, currentUser.ID, false)
+	if !ok {
+		return
+	}
+
+	if share.Status != models.ShareStatusPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Invitation is already answered!"})
+		return
+	}
+
+	share.Status = status
+	if err := initializers.DB.Save(&share).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant answer invitation!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation " + string(status) + "!", "status": share.Status})
+}
@@ -0,0 +1,187 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TaskSmartListMaxCount = 50
+
+var errTaskSmartListLimit = errors.New("too many smart lists")
+
+func isValidSmartListName(name string) bool {
+	name = strings.TrimSpace(name)
+	return len(name) >= 1 && len(name) <= 50
+}
+
+// check that query can be parsed, returns message for user
+func validateSmartListQuery(c *gin.Context, query string) string {
+	user, _ := c.Get("user")
+	if strings.TrimSpace(query) == "" {
+		return "Query cant be empty!"
+	}
+	if !utils.IsValidTaskQueryLength(query) {
+		return "Query must be max " + strconv.Itoa(utils.TaskQueryMaxLength) + " characters!"
+	}
+	if _, err := utils.ParseTaskQuery(query, time.Now(), user.(models.User).Location()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func loadTaskSmartLists(ownerID uint) ([]models.TaskSmartListModel, error) {
+	smartLists := []models.TaskSmartListModel{}
+	err := initializers.DB.Where("user_id = ?", ownerID).Order("name asc, id asc").Find(&smartLists).Error
+	return smartLists, err
+}
+
+// find smart list of list from url param
+func findTaskSmartList(c *gin.Context, ownerID uint) (models.TaskSmartListModel, bool) {
+	var smartList models.TaskSmartListModel
+
+	smartListID, err := strconv.Atoi(c.Param("listId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong smart list id!"})
+		return smartList, false
+	}
+
+	if err := initializers.DB.Where("id = ? AND user_id = ?", smartListID, ownerID).First(&smartList).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Smart list not found!"})
+		return smartList, false
+	}
+
+	return smartList, true
+}
+
+// saved queries of list, tasks of one are loaded with GET /tasks?smartList=<id>
+func GetTaskSmartLists(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	smartLists, err := loadTaskSmartLists(ownerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load smart lists!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": smartLists})
+}
+
+func CreateTaskSmartList(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var input struct {
+		Name  string `json:"name" binding:"required"`
+		Query string `json:"query" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isValidSmartListName(input.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"smartListError": "Smart list name must be between 1 and 50 characters!"})
+		return
+	}
+
+	if message := validateSmartListQuery(c, input.Query); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"queryError": message})
+		return
+	}
+
+	smartList := models.TaskSmartListModel{
+		UserID: ownerID,
+		Name:   strings.TrimSpace(input.Name),
+		Query:  strings.TrimSpace(input.Query),
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.TaskSmartListModel{}).Where("user_id = ?", ownerID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= TaskSmartListMaxCount {
+			return errTaskSmartListLimit
+		}
+		return tx.Create(&smartList).Error
+	})
+	if errors.Is(err, errTaskSmartListLimit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "List can have max " + strconv.Itoa(TaskSmartListMaxCount) + " smart lists!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant save smart list!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": smartList})
+}
+
+// rename smart list or change its query
+func UpdateTaskSmartList(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	smartList, ok := findTaskSmartList(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name  *string `json:"name"`
+		Query *string `json:"query"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		if !isValidSmartListName(*input.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"smartListError": "Smart list name must be between 1 and 50 characters!"})
+			return
+		}
+		updates["name"] = strings.TrimSpace(*input.Name)
+	}
+	if input.Query != nil {
+		if message := validateSmartListQuery(c, *input.Query); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"queryError": message})
+			return
+		}
+		updates["query"] = strings.TrimSpace(*input.Query)
+	}
+
+	if len(updates) > 0 {
+		if err := initializers.DB.Model(&smartList).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant update smart list!"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": smartList})
+}
+
+func DeleteTaskSmartList(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	smartList, ok := findTaskSmartList(c, ownerID)
+	if !ok {
+		return
+	}
+
+	if err := initializers.DB.Unscoped().Delete(&smartList).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete smart list!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Smart list deleted!"})
+}
@@ -0,0 +1,352 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TaskTemplateMaxCount = 50
+	TaskTemplateMaxItems = 50
+)
+
+var errTaskTemplateLimit = errors.New("too many templates")
+
+type taskTemplateItemInput struct {
+	Title       string   `json:"title" binding:"required"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+func isValidTemplateName(name string) bool {
+	name = strings.TrimSpace(name)
+	return len(name) >= 1 && len(name) <= 50
+}
+
+// check items like CreateTask does, variables are filled in first so rendered task fits too.
+// returns message for the first wrong item
+func validateTemplateItems(items []taskTemplateItemInput, now time.Time, loc *time.Location) string {
+	if len(items) == 0 || len(items) > TaskTemplateMaxItems {
+		return "Template must have between 1 and " + strconv.Itoa(TaskTemplateMaxItems) + " tasks!"
+	}
+
+	for i, item := range items {
+		position := "Task " + strconv.Itoa(i+1) + ": "
+		if !utils.IsValidTitle(item.Title) || !utils.IsValidTitle(utils.RenderTaskTemplate(item.Title, now, loc)) {
+			return position + "Title must be between 2 and 95 characters!"
+		}
+		if item.Description != "" && !utils.IsValidDescription(utils.RenderTaskTemplate(item.Description, now, loc)) {
+			return position + "Description must be  between 2 and 870 characters!"
+		}
+	}
+	return ""
+}
+
+// task title cut to length of template name
+func templateNameFromTitle(title string) string {
+	runes := []rune(strings.TrimSpace(title))
+	if len(runes) > 50 {
+		runes = runes[:50]
+	}
+	return strings.TrimSpace(string(runes))
+}
+
+func templateItemsFromInput(items []taskTemplateItemInput) []models.TaskTemplateItemModel {
+	result := make([]models.TaskTemplateItemModel, 0, len(items))
+	for i, item := range items {
+		result = append(result, models.TaskTemplateItemModel{
+			Position:    i + 1,
+			Title:       item.Title,
+			Description: item.Description,
+			Tags:        models.NormalizeTags(item.Tags),
+		})
+	}
+	return result
+}
+
+// templates of list with their items in order
+func loadTaskTemplates(query *gorm.DB) ([]models.TaskTemplateModel, error) {
+	var templates []models.TaskTemplateModel
+	err := query.Preload("Items", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position asc")
+	}).Order("name asc, id asc").Find(&templates).Error
+	return templates, err
+}
+
+// find template of list from url param
+func findTaskTemplate(c *gin.Context, ownerID uint) (models.TaskTemplateModel, bool) {
+	var template models.TaskTemplateModel
+
+	templateID, err := strconv.Atoi(c.Param("templateId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong template id!"})
+		return template, false
+	}
+
+	templates, err := loadTaskTemplates(initializers.DB.Where("id = ? AND user_id = ?", templateID, ownerID))
+	if err != nil || len(templates) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Template not found!"})
+		return template, false
+	}
+
+	return templates[0], true
+}
+
+// store new template, list can have only limited number of them
+func createTaskTemplate(template *models.TaskTemplateModel) error {
+	return initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.TaskTemplateModel{}).Where("user_id = ?", template.UserID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count >= TaskTemplateMaxCount {
+			return errTaskTemplateLimit
+		}
+		return tx.Create(template).Error
+	})
+}
+
+func respondTaskTemplateCreated(c *gin.Context, template models.TaskTemplateModel, err error) {
+	if errors.Is(err, errTaskTemplateLimit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "List can have max " + strconv.Itoa(TaskTemplateMaxCount) + " templates!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant save template!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": template})
+}
+
+func GetTaskTemplates(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	templates, err := loadTaskTemplates(initializers.DB.Where("user_id = ?", ownerID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load templates!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      templates,
+		"variables": utils.TaskTemplateVariables,
+	})
+}
+
+func CreateTaskTemplate(c *gin.Context) {
+	user, _ := c.Get("user")
+	ownerID := taskOwnerID(c)
+
+	var input struct {
+		Name  string                  `json:"name" binding:"required"`
+		Items []taskTemplateItemInput `json:"items" binding:"required,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isValidTemplateName(input.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"templateError": "Template name must be between 1 and 50 characters!"})
+		return
+	}
+
+	if message := validateTemplateItems(input.Items, time.Now(), user.(models.User).Location()); message != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"templateError": message})
+		return
+	}
+
+	template := models.TaskTemplateModel{
+		UserID: ownerID,
+		Name:   strings.TrimSpace(input.Name),
+		Items:  templateItemsFromInput(input.Items),
+	}
+	respondTaskTemplateCreated(c, template, createTaskTemplate(&template))
+}
+
+// save existing task of list as template with one item
+func SaveTaskAsTemplate(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	//body is optional here
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	//task title is used when no name is given
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		name = templateNameFromTitle(task.Title)
+	}
+	if !isValidTemplateName(name) {
+		c.JSON(http.StatusBadRequest, gin.H{"templateError": "Template name must be between 1 and 50 characters!"})
+		return
+	}
+
+	template := models.TaskTemplateModel{
+		UserID: ownerID,
+		Name:   name,
+		Items: []models.TaskTemplateItemModel{{
+			Position:    1,
+			Title:       task.Title,
+			Description: task.Description,
+			Tags:        task.Tags,
+		}},
+	}
+	respondTaskTemplateCreated(c, template, createTaskTemplate(&template))
+}
+
+// rename template and replace its items
+func UpdateTaskTemplate(c *gin.Context) {
+	user, _ := c.Get("user")
+	ownerID := taskOwnerID(c)
+
+	template, ok := findTaskTemplate(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name  *string                 `json:"name"`
+		Items []taskTemplateItemInput `json:"items" binding:"omitempty,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name != nil && !isValidTemplateName(*input.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"templateError": "Template name must be between 1 and 50 characters!"})
+		return
+	}
+
+	if input.Items != nil {
+		if message := validateTemplateItems(input.Items, time.Now(), user.(models.User).Location()); message != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"templateError": message})
+			return
+		}
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Name != nil {
+			if err := tx.Model(&template).Update("name", strings.TrimSpace(*input.Name)).Error; err != nil {
+				return err
+			}
+		}
+
+		if input.Items == nil {
+			return nil
+		}
+		if err := tx.Unscoped().Where("template_id = ?", template.ID).Delete(&models.TaskTemplateItemModel{}).Error; err != nil {
+			return err
+		}
+		items := templateItemsFromInput(input.Items)
+		for i := range items {
+			items[i].TemplateID = template.ID
+		}
+		return tx.Create(&items).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant update template!"})
+		return
+	}
+
+	template, ok = findTaskTemplate(c, ownerID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": template})
+}
+
+func DeleteTaskTemplate(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	template, ok := findTaskTemplate(c, ownerID)
+	if !ok {
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("template_id = ?", template.ID).Delete(&models.TaskTemplateItemModel{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&template).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete template!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Template deleted!"})
+}
+
+// create tasks from template items, variables are filled in the time zone of user who uses it.
+// all tasks are one change in history, so they can be undone together
+func UseTaskTemplate(c *gin.Context) {
+	user, _ := c.Get("user")
+	ownerID := taskOwnerID(c)
+
+	template, ok := findTaskTemplate(c, ownerID)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	loc := user.(models.User).Location()
+
+	tasks := make([]models.TasksModel, 0, len(template.Items))
+	for i, item := range template.Items {
+		task := models.TasksModel{
+			UserID:      ownerID,
+			Title:       utils.RenderTaskTemplate(item.Title, now, loc),
+			Description: utils.RenderTaskTemplate(item.Description, now, loc),
+			Tags:        item.Tags,
+		}
+
+		//filled variables can make text longer than it was when template was saved
+		if !utils.IsValidTitle(task.Title) {
+			c.JSON(http.StatusBadRequest, gin.H{"templateError": "Task " + strconv.Itoa(i+1) + ": Title must be between 2 and 95 characters!"})
+			return
+		}
+		if task.Description != "" && !utils.IsValidDescription(task.Description) {
+			c.JSON(http.StatusBadRequest, gin.H{"templateError": "Task " + strconv.Itoa(i+1) + ": Description must be  between 2 and 870 characters!"})
+			return
+		}
+
+		tasks = append(tasks, task)
+	}
+
+	created, err := createImportedTasks(tasks)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant create tasks from template!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventCreated, created)
+
+	c.JSON(http.StatusOK, gin.H{"data": created})
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"gorm.io/gorm"
+	"log"
+	"server/initializers"
+	"server/models"
+	"time"
+)
+
+const (
+	TaskArchiveMaxDays  = 365
+	TaskArchiveInterval = 1 * time.Hour
+)
+
+// completed flag with moment it changed, task opened again leaves archive
+func taskCompletionValues(task models.TasksModel, completed bool) map[string]interface{} {
+	values := map[string]interface{}{"completed": completed}
+	if completed == task.Completed {
+		return values
+	}
+
+	if completed {
+		values["completed_at"] = time.Now()
+	} else {
+		values["completed_at"] = nil
+		values["archived_at"] = nil
+	}
+	return values
+}
+
+// archive tasks of users with policy, which were completed more than their days ago.
+// tasks completed before completion moment was recorded use time of their last change
+func ArchiveCompletedTasks() (int, error) {
+	var users []models.User
+	if err := initializers.DB.Select("id", "archive_after_days").Where("archive_after_days > 0").Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	count := 0
+	for _, user := range users {
+		cutoff := now.AddDate(0, 0, -int(user.ArchiveAfterDays))
+
+		var tasks []models.TasksModel
+		if err := initializers.DB.
+			Where("user_id = ? AND completed = ? AND archived_at IS NULL AND COALESCE(completed_at, updated_at) < ?", user.ID, true, cutoff).
+			Find(&tasks).Error; err != nil {
+			return count, err
+		}
+		if len(tasks) == 0 {
+			continue
+		}
+
+		ids := make([]uint, 0, len(tasks))
+		for _, task := range tasks {
+			ids = append(ids, task.ID)
+		}
+
+		//conditions are repeated, task reopened since select must stay in the list.
+		//version is bumped, so sync and stale copies see task left the list
+		var localIDs []uint
+		if err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+			result := tx.Model(&models.TasksModel{}).
+				Where("id IN ? AND completed = ? AND archived_at IS NULL", ids, true).
+				Updates(map[string]interface{}{
+					"archived_at": now,
+					"version":     gorm.Expr("version + 1"),
+				})
+			if result.Error != nil || result.RowsAffected == 0 {
+				return result.Error
+			}
+			return tx.Model(&models.TasksModel{}).
+				Where("id IN ? AND archived_at IS NOT NULL", ids).
+				Pluck("local_id", &localIDs).Error
+		}); err != nil {
+			return count, err
+		}
+		if len(localIDs) == 0 {
+			continue
+		}
+
+		invalidateUserTaskCaches(user.ID)
+		taskEvents.publish(user.ID, TaskEvent{Type: TaskEventDeleted, LocalIDs: localIDs})
+		count += len(localIDs)
+	}
+	return count, nil
+}
+
+func StartTaskArchiver() {
+	go func() {
+		ticker := time.NewTicker(TaskArchiveInterval)
+		defer ticker.Stop()
+
+		for {
+			count, err := ArchiveCompletedTasks()
+			if err != nil {
+				log.Printf("Failed to archive completed tasks: %v", err)
+			} else if count > 0 {
+				log.Printf("Archived %d completed tasks", count)
+			}
+			<-ticker.C
+		}
+	}()
+}
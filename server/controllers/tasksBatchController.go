@@ -0,0 +1,367 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/utils"
+	"strconv"
+)
+
+const TasksBatchMaxOperations = 100
+
+const (
+	TaskOpCreate   = "create"
+	TaskOpUpdate   = "update"
+	TaskOpComplete = "complete"
+	TaskOpDelete   = "delete"
+	TaskOpMove     = "move"
+)
+
+// one operation of a batch request, fields are used depending on op
+type taskOperation struct {
+	Op          string   `json:"op" binding:"required"`
+	LocalID     uint     `json:"localId"`
+	ClientID    string   `json:"clientId"`
+	Title       *string  `json:"title"`
+	Description *string  `json:"description"`
+	Completed   *bool    `json:"completed"`
+	Order       *float64 `json:"order"`
+	After       *uint    `json:"after"`
+	Before      *uint    `json:"before"`
+	Version     *uint    `json:"version"`
+
+	//set by sync for ops which win over any version, clients cant send it
+	anyVersion bool
+}
+
+type taskOperationResult struct {
+	Index  int                `json:"index"`
+	Op     string             `json:"op"`
+	Status string             `json:"status"`
+	Error  string             `json:"error,omitempty"`
+	Task   *models.TasksModel `json:"task,omitempty"`
+}
+
+// error which message can be shown to client
+type taskOperationError string
+
+func (e taskOperationError) Error() string { return string(e) }
+
+const (
+	errBatchTaskNotFound     = taskOperationError("Cant find a task!")
+	errBatchUnknownOperation = taskOperationError("Unknown operation!")
+	errBatchInvalidTitle     = taskOperationError("Title must be between 2 and 95 characters!")
+	errBatchInvalidDesc      = taskOperationError("Description must be  between 2 and 870 characters!")
+	errBatchMissingField     = taskOperationError("Operation has nothing to change!")
+	errBatchVersionConflict  = taskOperationError("Task was changed by someone else!")
+	errBatchVersionRequired  = taskOperationError("Task version is required!")
+	errBatchInvalidClientID  = taskOperationError("Client id must be at most 64 characters!")
+)
+
+// apply one operation inside batch transaction, true if a move renumbered the whole list
+func applyTaskOperation(tx *gorm.DB, userID uint, op taskOperation) (models.TasksModel, []models.TaskHistoryModel, bool, error) {
+	var task models.TasksModel
+	var history []models.TaskHistoryModel
+
+	if len(op.ClientID) > 64 {
+		return task, nil, false, errBatchInvalidClientID
+	}
+
+	if op.Op == TaskOpCreate {
+		//create sent again after lost response returns the task made first time
+		if op.ClientID != "" {
+			err := tx.Unscoped().Where("user_id = ? AND client_id = ?", userID, op.ClientID).First(&task).Error
+			if err == nil {
+				return task, nil, false, nil
+			}
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return task, nil, false, err
+			}
+		}
+
+		if op.Title == nil || !utils.IsValidTitle(*op.Title) {
+			return task, nil, false, errBatchInvalidTitle
+		}
+		description := ""
+		if op.Description != nil {
+			description = *op.Description
+		}
+		if !utils.IsValidDescription(description) {
+			return task, nil, false, errBatchInvalidDesc
+		}
+
+		newTask := models.TasksModel{
+			UserID:      userID,
+			Title:       *op.Title,
+			Description: description,
+			Inbox:       true,
+		}
+		if op.ClientID != "" {
+			newTask.ClientID = &op.ClientID
+		}
+		task, err := createTask(tx, newTask)
+		if err != nil {
+			return task, nil, false, err
+		}
+		return task, append(history, newTaskHistory(task, models.TaskActionCreated, "", task.Title)), false, nil
+	}
+
+	//task created offline is known to client only by its client id
+	query := tx.Where("local_id = ? AND user_id = ?", op.LocalID, userID)
+	if op.LocalID == 0 && op.ClientID != "" {
+		query = tx.Where("client_id = ? AND user_id = ?", op.ClientID, userID)
+	}
+	if err := query.First(&task).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return task, nil, false, errBatchTaskNotFound
+		}
+		return task, nil, false, err
+	}
+
+	//like single task endpoints, change needs version client based it on. delete is not versioned
+	var version uint
+	switch {
+	case op.Version != nil:
+		version = *op.Version
+	case op.Op == TaskOpDelete || op.anyVersion:
+		version = task.Version
+	default:
+		return task, nil, false, errBatchVersionRequired
+	}
+	if version != task.Version {
+		return task, nil, false, errBatchVersionConflict
+	}
+
+	switch op.Op {
+	case TaskOpUpdate:
+		if op.Title == nil && op.Description == nil {
+			return task, nil, false, errBatchMissingField
+		}
+		values := map[string]interface{}{}
+		if op.Title != nil {
+			if !utils.IsValidTitle(*op.Title) {
+				return task, nil, false, errBatchInvalidTitle
+			}
+			if *op.Title != task.Title {
+				history = append(history, newTaskHistory(task, models.TaskActionTitleChanged, task.Title, *op.Title))
+				values["title"] = *op.Title
+			}
+		}
+		if op.Description != nil {
+			if !utils.IsValidDescription(*op.Description) {
+				return task, nil, false, errBatchInvalidDesc
+			}
+			if *op.Description != task.Description {
+				history = append(history, newTaskHistory(task, models.TaskActionDescriptionChanged, task.Description, *op.Description))
+				values["description"] = *op.Description
+			}
+		}
+		return task, history, false, updateBatchTask(tx, &task, version, values)
+
+	case TaskOpComplete:
+		completed := true
+		if op.Completed != nil {
+			completed = *op.Completed
+		}
+		if completed != task.Completed {
+			if err := touchDependents(tx, task.ID); err != nil {
+				return task, nil, false, err
+			}
+			action := models.TaskActionCompleted
+			if !completed {
+				action = models.TaskActionUncompleted
+			}
+			history = append(history, newTaskHistory(task, action, strconv.FormatBool(task.Completed), strconv.FormatBool(completed)))
+		}
+		values := taskCompletionValues(task, completed)
+		if err := addColumnCompletionUpdate(tx, task, completed, values); err != nil {
+			return task, nil, false, err
+		}
+		return task, history, false, updateBatchTask(tx, &task, version, values)
+
+	case TaskOpDelete:
+		if err := tx.Delete(&task).Error; err != nil {
+			return task, nil, false, err
+		}
+		if err := touchDependents(tx, task.ID); err != nil {
+			return task, nil, false, err
+		}
+		return task, append(history, newTaskHistory(task, models.TaskActionDeleted, "", "")), false, nil
+
+	case TaskOpMove:
+		//move by exact order or between two tasks
+		var order float64
+		var renumbered bool
+		switch {
+		case op.Order != nil:
+			order = *op.Order
+		case op.After != nil || op.Before != nil:
+			var err error
+			order, renumbered, err = taskOrderBetween(tx, userID, task.ID, op.After, op.Before)
+			if errors.Is(err, errTaskOrderNeighbour) {
+				return task, nil, false, errBatchTaskNotFound
+			}
+			if errors.Is(err, errTaskOrderConflict) {
+				return task, nil, false, errBatchVersionConflict
+			}
+			if err != nil {
+				return task, nil, false, err
+			}
+		default:
+			return task, nil, false, errBatchMissingField
+		}
+		if order != task.Order {
+			oldPosition, err := taskPositionValue(tx, task.ID)
+			if err != nil {
+				return task, nil, false, err
+			}
+			history = append(history, newTaskHistory(task, models.TaskActionReordered, oldPosition, formatTaskOrder(order)))
+		}
+		return task, history, renumbered, updateBatchTask(tx, &task, version, map[string]interface{}{"order": order})
+	}
+
+	return task, nil, false, errBatchUnknownOperation
+}
+
+// versioned update, conflict is reported as operation error
+func updateBatchTask(tx *gorm.DB, task *models.TasksModel, version uint, values map[string]interface{}) error {
+	err := updateTaskVersioned(tx, task, version, values)
+	if errors.Is(err, errTaskVersionConflict) {
+		return errBatchVersionConflict
+	}
+	return err
+}
+
+// events of applied batch, tasks changed by several operations are sent in their last state
+func broadcastBatchResults(c *gin.Context, ownerID uint, results []taskOperationResult) {
+	eventTypes := map[string]string{
+		TaskOpCreate:   TaskEventCreated,
+		TaskOpUpdate:   TaskEventUpdated,
+		TaskOpComplete: TaskEventCompleted,
+		TaskOpMove:     TaskEventReordered,
+	}
+
+	last := make(map[uint]int)
+	for i, result := range results {
+		last[result.Task.ID] = i
+	}
+
+	byType := make(map[string][]models.TasksModel)
+	var deleted []models.TasksModel
+	var blockerIDs []uint
+	for i, result := range results {
+		if result.Op == TaskOpComplete || result.Op == TaskOpDelete {
+			blockerIDs = append(blockerIDs, result.Task.ID)
+		}
+		if last[result.Task.ID] != i {
+			continue
+		}
+		if result.Op == TaskOpDelete {
+			deleted = append(deleted, *result.Task)
+			continue
+		}
+		byType[eventTypes[result.Op]] = append(byType[eventTypes[result.Op]], *result.Task)
+	}
+
+	for _, eventType := range []string{TaskEventCreated, TaskEventUpdated, TaskEventCompleted, TaskEventReordered} {
+		broadcastTaskEvent(c, ownerID, eventType, byType[eventType])
+	}
+	broadcastTasksDeleted(c, ownerID, deleted)
+	broadcastDependents(c, ownerID, blockerIDs...)
+}
+
+// apply list of operations atomically, if one fails nothing is saved
+func BatchTasks(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var input struct {
+		Operations []taskOperation `json:"operations" binding:"required,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(input.Operations) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No operations to apply!"})
+		return
+	}
+
+	if len(input.Operations) > TasksBatchMaxOperations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many operations, max is " + strconv.Itoa(TasksBatchMaxOperations) + "!"})
+		return
+	}
+
+	results := make([]taskOperationResult, len(input.Operations))
+	for i, op := range input.Operations {
+		results[i] = taskOperationResult{Index: i, Op: op.Op, Status: "skipped"}
+	}
+
+	failed := -1
+	renumbered := false
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var history []models.TaskHistoryModel
+		for i, op := range input.Operations {
+			task, opHistory, opRenumbered, err := applyTaskOperation(tx, ownerID, op)
+			if err != nil {
+				failed = i
+				return err
+			}
+			renumbered = renumbered || opRenumbered
+			results[i].Status = "ok"
+			results[i].Task = &task
+			history = append(history, opHistory...)
+		}
+
+		//whole batch is one history group, so undo reverts all of it
+		return recordTaskHistory(tx, history...)
+	})
+
+	if err != nil {
+		//nothing was saved, drop partial results
+		for i := 0; i < failed; i++ {
+			results[i].Status = "rolledBack"
+			results[i].Task = nil
+		}
+
+		var opErr taskOperationError
+		if failed >= 0 && errors.As(err, &opErr) {
+			results[failed].Status = "failed"
+			results[failed].Error = opErr.Error()
+
+			switch opErr {
+			case errBatchVersionConflict:
+				//server copy of conflicting task, so client can merge or retry
+				current, findErr := findSyncedTask(ownerID, input.Operations[failed])
+				if findErr != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant apply batch!"})
+					return
+				}
+				results[failed].Task = &current
+				c.Header("ETag", taskETag(current))
+				c.JSON(http.StatusConflict, gin.H{"error": "Batch was not applied!", "results": results, "data": current})
+			case errBatchVersionRequired:
+				c.JSON(http.StatusPreconditionRequired, gin.H{"error": "Batch was not applied!", "results": results})
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Batch was not applied!", "results": results})
+			}
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant apply batch!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastBatchResults(c, ownerID, results)
+	if renumbered {
+		publishRebalancedOrder(ownerID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": results})
+}
@@ -0,0 +1,565 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const TaskColumnMaxCount = 20
+
+// columns every list starts with, the last one completes tasks
+var defaultTaskColumns = []models.TaskColumnModel{
+	{Name: "Todo"},
+	{Name: "In progress"},
+	{Name: "Review"},
+	{Name: "Done", IsDone: true},
+}
+
+var (
+	errTaskColumnRequired = errors.New("list needs done and not done column")
+	errTaskColumnLimit    = errors.New("too many columns")
+)
+
+type taskColumnResponse struct {
+	ID     uint                `json:"id"`
+	Name   string              `json:"name"`
+	Order  float64             `json:"order"`
+	IsDone bool                `json:"isDone"`
+	Tasks  []models.TasksModel `json:"tasks"`
+}
+
+func isValidColumnName(name string) bool {
+	name = strings.TrimSpace(name)
+	return len(name) >= 1 && len(name) <= 50
+}
+
+func formatColumnID(columnID *uint) string {
+	if columnID == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(*columnID), 10)
+}
+
+// columns of list in board order, default ones are created on first use
+func ensureTaskColumns(tx *gorm.DB, ownerID uint) ([]models.TaskColumnModel, error) {
+	var columns []models.TaskColumnModel
+	if err := tx.Where("user_id = ?", ownerID).Order("`order` asc, id asc").Find(&columns).Error; err != nil {
+		return nil, err
+	}
+	if len(columns) > 0 {
+		return columns, nil
+	}
+
+	//first board loads can come at once, row of user is locked so only one of them creates columns.
+	//locking read sees columns committed by the one which was first, plain read would not
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, ownerID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("user_id = ?", ownerID).Order("`order` asc, id asc").Find(&columns).Error; err != nil {
+		return nil, err
+	}
+	if len(columns) > 0 {
+		return columns, nil
+	}
+
+	for i, column := range defaultTaskColumns {
+		column.UserID = ownerID
+		column.Order = float64(i+1) * TaskOrderStep
+		columns = append(columns, column)
+	}
+	if err := tx.Create(&columns).Error; err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// column task is shown in, tasks without own column go to first column of their state
+func resolveTaskColumn(task models.TasksModel, columns []models.TaskColumnModel) uint {
+	if task.ColumnID != nil {
+		for _, column := range columns {
+			if column.ID == *task.ColumnID {
+				return column.ID
+			}
+		}
+	}
+	for _, column := range columns {
+		if column.IsDone == task.Completed {
+			return column.ID
+		}
+	}
+	return columns[0].ID
+}
+
+// when completed changes outside of board, task leaves column which does not fit anymore
+func addColumnCompletionUpdate(tx *gorm.DB, task models.TasksModel, completed bool, values map[string]interface{}) error {
+	if task.ColumnID == nil {
+		return nil
+	}
+
+	var column models.TaskColumnModel
+	err := tx.Where("id = ? AND user_id = ?", *task.ColumnID, task.UserID).First(&column).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && column.IsDone != completed) {
+		values["column_id"] = nil
+		return nil
+	}
+	return err
+}
+
+// list must keep at least one done and one not done column, so Completed can be mapped
+func checkTaskColumnsLeft(tx *gorm.DB, ownerID uint, exceptID uint, isDone bool) error {
+	var count int64
+	if err := tx.Model(&models.TaskColumnModel{}).
+		Where("user_id = ? AND id <> ? AND is_done = ?", ownerID, exceptID, isDone).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errTaskColumnRequired
+	}
+	return nil
+}
+
+// find column of list from url param
+func findTaskColumn(c *gin.Context, ownerID uint) (models.TaskColumnModel, bool) {
+	var column models.TaskColumnModel
+
+	columnID, err := strconv.Atoi(c.Param("columnId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong column id!"})
+		return column, false
+	}
+
+	if err := initializers.DB.Where("id = ? AND user_id = ?", columnID, ownerID).First(&column).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Column not found!"})
+		return column, false
+	}
+
+	return column, true
+}
+
+// order key of column between two others, nil means edge of the board
+func columnOrderBetween(tx *gorm.DB, ownerID uint, afterID *uint, beforeID *uint) (float64, error) {
+	var after, before models.TaskColumnModel
+	if afterID != nil {
+		if err := tx.Where("id = ? AND user_id = ?", *afterID, ownerID).First(&after).Error; err != nil {
+			return 0, err
+		}
+	}
+	if beforeID != nil {
+		if err := tx.Where("id = ? AND user_id = ?", *beforeID, ownerID).First(&before).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	var low, high *float64
+	if afterID != nil {
+		low = &after.Order
+	}
+	if beforeID != nil {
+		high = &before.Order
+	}
+
+	order, ok := midTaskOrder(low, high)
+	if !ok {
+		return 0, errTaskOrderConflict
+	}
+	return order, nil
+}
+
+// tasks of list grouped by columns, each column sorted by task order
+func GetTasksBoard(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var columns []models.TaskColumnModel
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		columns, err = ensureTaskColumns(tx, ownerID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load board!"})
+		return
+	}
+
+	query := initializers.DB.Where("user_id = ? AND archived_at IS NULL", ownerID)
+	if c.Query("showDeferred") != "true" {
+		query = query.Where(visibleTaskCondition, time.Now())
+	}
+
+	var tasks []models.TasksModel
+	if err := query.Order("`order` asc, id asc").Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load board!"})
+		return
+	}
+
+	if err := attachCommentCounts(tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant count task comments!"})
+		return
+	}
+
+	if err := attachTaskDependencies(tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task dependencies!"})
+		return
+	}
+
+	byColumn := make(map[uint][]models.TasksModel)
+	for _, task := range tasks {
+		columnID := resolveTaskColumn(task, columns)
+		byColumn[columnID] = append(byColumn[columnID], task)
+	}
+
+	response := make([]taskColumnResponse, 0, len(columns))
+	for _, column := range columns {
+		columnTasks := byColumn[column.ID]
+		if columnTasks == nil {
+			columnTasks = []models.TasksModel{}
+		}
+		response = append(response, taskColumnResponse{
+			ID:     column.ID,
+			Name:   column.Name,
+			Order:  column.Order,
+			IsDone: column.IsDone,
+			Tasks:  columnTasks,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": response})
+}
+
+func CreateTaskColumn(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var input struct {
+		Name   string `json:"name" binding:"required"`
+		IsDone bool   `json:"isDone"`
+		After  *uint  `json:"after"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !isValidColumnName(input.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"columnError": "Column name must be between 1 and 50 characters!"})
+		return
+	}
+
+	var column models.TaskColumnModel
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		columns, err := ensureTaskColumns(tx, ownerID)
+		if err != nil {
+			return err
+		}
+		if len(columns) >= TaskColumnMaxCount {
+			return errTaskColumnLimit
+		}
+
+		//new column goes after given one or to the end
+		after := input.After
+		if after == nil {
+			after = &columns[len(columns)-1].ID
+		}
+		var before *uint
+		for i, existing := range columns {
+			if existing.ID == *after && i+1 < len(columns) {
+				before = &columns[i+1].ID
+			}
+		}
+
+		order, err := columnOrderBetween(tx, ownerID, after, before)
+		if err != nil {
+			return err
+		}
+
+		column = models.TaskColumnModel{
+			UserID: ownerID,
+			Name:   strings.TrimSpace(input.Name),
+			Order:  order,
+			IsDone: input.IsDone,
+		}
+		return tx.Create(&column).Error
+	})
+	if errors.Is(err, errTaskColumnLimit) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Board can have max " + strconv.Itoa(TaskColumnMaxCount) + " columns!"})
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Column not found!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant create column!"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": column})
+}
+
+// rename column, change if it completes tasks or move it between two others
+func UpdateTaskColumn(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	column, ok := findTaskColumn(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name   *string `json:"name"`
+		IsDone *bool   `json:"isDone"`
+		After  *uint   `json:"after"`
+		Before *uint   `json:"before"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name != nil && !isValidColumnName(*input.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"columnError": "Column name must be between 1 and 50 characters!"})
+		return
+	}
+
+	var changedIDs []uint
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		values := map[string]interface{}{}
+
+		if input.Name != nil {
+			values["name"] = strings.TrimSpace(*input.Name)
+		}
+
+		if input.After != nil || input.Before != nil {
+			order, err := columnOrderBetween(tx, ownerID, input.After, input.Before)
+			if err != nil {
+				return err
+			}
+			values["order"] = order
+		}
+
+		if input.IsDone != nil && *input.IsDone != column.IsDone {
+			if err := checkTaskColumnsLeft(tx, ownerID, column.ID, column.IsDone); err != nil {
+				return err
+			}
+			values["is_done"] = *input.IsDone
+
+			//tasks of the column follow its new state
+			if err := tx.Model(&models.TasksModel{}).
+				Where("user_id = ? AND column_id = ?", ownerID, column.ID).
+				Pluck("id", &changedIDs).Error; err != nil {
+				return err
+			}
+			taskValues := taskCompletionValues(models.TasksModel{Completed: column.IsDone}, *input.IsDone)
+			taskValues["version"] = gorm.Expr("version + 1")
+			if err := tx.Model(&models.TasksModel{}).
+				Where("user_id = ? AND column_id = ?", ownerID, column.ID).
+				Updates(taskValues).Error; err != nil {
+				return err
+			}
+			if err := touchDependents(tx, changedIDs...); err != nil {
+				return err
+			}
+		}
+
+		if len(values) == 0 {
+			return nil
+		}
+		if err := tx.Model(&column).Updates(values).Error; err != nil {
+			return err
+		}
+		return tx.First(&column, column.ID).Error
+	})
+	switch {
+	case errors.Is(err, errTaskColumnRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Board needs at least one done and one not done column!"})
+		return
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Column not found!"})
+		return
+	case errors.Is(err, errTaskOrderConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Columns order was changed, reload the board!"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant update column!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventCompleted, tasksByIDs(changedIDs))
+	broadcastDependents(c, ownerID, changedIDs...)
+
+	c.JSON(http.StatusOK, gin.H{"data": column})
+}
+
+// delete column, its tasks go to first column of their state
+func DeleteTaskColumn(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	column, ok := findTaskColumn(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var changedIDs []uint
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkTaskColumnsLeft(tx, ownerID, column.ID, column.IsDone); err != nil {
+			return err
+		}
+		if err := tx.Model(&models.TasksModel{}).
+			Where("user_id = ? AND column_id = ?", ownerID, column.ID).
+			Pluck("id", &changedIDs).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Model(&models.TasksModel{}).
+			Where("user_id = ? AND column_id = ?", ownerID, column.ID).
+			Updates(map[string]interface{}{
+				"column_id": nil,
+				"version":   gorm.Expr("version + 1"),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&column).Error
+	})
+	if errors.Is(err, errTaskColumnRequired) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Board needs at least one done and one not done column!"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete column!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventUpdated, tasksByIDs(changedIDs))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Column deleted!"})
+}
+
+// move task to column, optionally between two tasks of it. Completed follows the column
+func MoveTaskToColumn(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	localTaskIDStr := c.Param("id")
+	localTaskID, err := strconv.Atoi(localTaskIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong task id!"})
+		return
+	}
+
+	var task models.TasksModel
+	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, ownerID).First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task!"})
+		return
+	}
+
+	var input struct {
+		ColumnID uint  `json:"columnId" binding:"required"`
+		After    *uint `json:"after"`
+		Before   *uint `json:"before"`
+		Version  *uint `json:"version"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (input.After != nil && *input.After == task.LocalID) || (input.Before != nil && *input.Before == task.LocalID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Task cant be moved next to itself!"})
+		return
+	}
+
+	var column models.TaskColumnModel
+	if err := initializers.DB.Where("id = ? AND user_id = ?", input.ColumnID, ownerID).First(&column).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Column not found!"})
+		return
+	}
+
+	version, ok := expectedTaskVersion(c, input.Version)
+	if !ok {
+		return
+	}
+
+	old := task
+	var renumbered bool
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		values := taskCompletionValues(task, column.IsDone)
+		values["column_id"] = column.ID
+
+		//into empty column or to its edge task keeps its order
+		if input.After != nil || input.Before != nil {
+			var order float64
+			var err error
+			order, renumbered, err = taskOrderBetween(tx, ownerID, task.ID, input.After, input.Before)
+			if err != nil {
+				return err
+			}
+			values["order"] = order
+		}
+
+		var oldPosition string
+		if _, ok := values["order"]; ok {
+			var err error
+			if oldPosition, err = taskPositionValue(tx, task.ID); err != nil {
+				return err
+			}
+		}
+		if err := updateTaskVersioned(tx, &task, version, values); err != nil {
+			return err
+		}
+
+		var history []models.TaskHistoryModel
+		if formatColumnID(old.ColumnID) != formatColumnID(task.ColumnID) {
+			history = append(history, newTaskHistory(task, models.TaskActionStatusChanged, formatColumnID(old.ColumnID), formatColumnID(task.ColumnID)))
+		}
+		if old.Completed != task.Completed {
+			if err := touchDependents(tx, task.ID); err != nil {
+				return err
+			}
+			action := models.TaskActionCompleted
+			if !task.Completed {
+				action = models.TaskActionUncompleted
+			}
+			history = append(history, newTaskHistory(task, action, strconv.FormatBool(old.Completed), strconv.FormatBool(task.Completed)))
+		}
+		if old.Order != task.Order {
+			history = append(history, newTaskHistory(task, models.TaskActionReordered, oldPosition, formatTaskOrder(task.Order)))
+		}
+		return recordTaskHistory(tx, history...)
+	})
+	switch {
+	case errors.Is(err, errTaskVersionConflict):
+		respondTaskConflict(c, task.ID)
+		return
+	case errors.Is(err, errTaskOrderNeighbour):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a neighbour task!"})
+		return
+	case errors.Is(err, errTaskOrderConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Tasks order was changed, reload the board!"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot move task!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventUpdated, []models.TasksModel{task})
+	if old.Completed != task.Completed {
+		broadcastDependents(c, ownerID, task.ID)
+	}
+	if renumbered {
+		publishRebalancedOrder(ownerID)
+	}
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
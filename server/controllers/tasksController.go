@@ -1,100 +1,413 @@
 package controllers
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
 	"net/http"
 	"server/initializers"
 	"server/models"
 	"server/utils"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const (
 	TasksCachePrefix = "tasks:"
 	TasksCacheTTL    = 15 * time.Minute
+
+	TasksPageDefaultSize = 50
+	TasksPageMaxSize     = 200
 )
 
-// Generate cache key for task lists with filters
-func getTasksListCacheKey(userID uint, hideCompleted bool, showTodayOnly bool) string {
-	return fmt.Sprintf("%s%d:hideCompleted:%t:todayOnly:%t", TasksCachePrefix, userID, hideCompleted, showTodayOnly)
+// position of last task on a page, tasks are sorted by order and id
+type tasksCursor struct {
+	Order float64 `json:"o"`
+	ID    uint    `json:"i"`
+}
+
+// one page of tasks list, how it is cached
+type tasksPage struct {
+	Tasks      []models.TasksModel `json:"tasks"`
+	NextCursor string              `json:"nextCursor"`
+	Total      *int64              `json:"total,omitempty"`
+}
+
+// key of users cache generation, every change of tasks increments it.
+// it has no ttl, otherwise counter could start again and hit old entries
+func getTasksCacheGenerationKey(userID uint) string {
+	return fmt.Sprintf("%s%d:gen", TasksCachePrefix, userID)
 }
 
-// cache tasks list by filters
-func cacheTaskList(userID uint, hideCompleted bool, showTodayOnly bool, tasks []models.TasksModel) error {
+// current cache generation of user, 0 until first change
+func getTasksCacheGeneration(userID uint) (int64, error) {
+	generation, err := initializers.RedisClient.Get(initializers.Ctx, getTasksCacheGenerationKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	}
+	return generation, err
+}
+
+// Generate cache key for task lists with filters.
+// generation is read before loading tasks, so a list loaded before invalidation
+// is written under old key which nobody reads anymore
+func getTasksListCacheKey(userID uint, generation int64, filter tasksFilter) string {
+	return fmt.Sprintf("%s%d:g%d:%s", TasksCachePrefix, userID, generation, filter.cacheKey())
+}
+
+// Generate cache key for one page of task list
+func getTasksPageCacheKey(userID uint, generation int64, filter tasksFilter, cursor string, limit int, withTotal bool) string {
+	return fmt.Sprintf("%s:page:%s:limit:%d:total:%t", getTasksListCacheKey(userID, generation, filter), cursor, limit, withTotal)
+}
+
+// cache one page of tasks list
+func cacheTasksPage(key string, page tasksPage) error {
+	pageJSON, err := json.Marshal(page)
+	if err != nil {
+		return err
+	}
+
+	return initializers.RedisClient.Set(initializers.Ctx, key, pageJSON, TasksCacheTTL).Err()
+}
+
+// cache tasks list under key of generation it was loaded in
+func cacheTaskList(key string, tasks []models.TasksModel) error {
 	tasksJSON, err := json.Marshal(tasks)
 	if err != nil {
 		return err
 	}
 
-	key := getTasksListCacheKey(userID, hideCompleted, showTodayOnly)
 	return initializers.RedisClient.Set(initializers.Ctx, key, tasksJSON, TasksCacheTTL).Err()
 }
 
-// invalidate all task caches for a user
+// invalidate all task caches for a user, entries of old generation just expire
 func invalidateUserTaskCaches(userID uint) {
-	// get all keys with the users prefix
-	pattern := fmt.Sprintf("%s%d:*", TasksCachePrefix, userID)
-	keys, err := initializers.RedisClient.Keys(initializers.Ctx, pattern).Result()
-	if err != nil {
+	initializers.RedisClient.Incr(initializers.Ctx, getTasksCacheGenerationKey(userID))
+}
+
+func GetAllTasks(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	//get filter params from req
+	filter, ok := tasksFilterFromQuery(c, ownerID)
+	if !ok {
+		return
+	}
+
+	//paginated listing is used if client asks for a page
+	if c.Query("limit") != "" || c.Query("cursor") != "" {
+		getTasksPage(c, ownerID, filter)
+		return
+	}
+
+	//without generation cache is skipped, stale list is worse than slow one
+	generation, genErr := getTasksCacheGeneration(ownerID)
+	cacheKey := getTasksListCacheKey(ownerID, generation, filter)
+
+	if genErr == nil {
+		cachedTasks, err := initializers.RedisClient.Get(initializers.Ctx, cacheKey).Result()
+		if err == nil {
+			// Found in cache
+			var tasks []models.TasksModel
+			if err := json.Unmarshal([]byte(cachedTasks), &tasks); err == nil {
+				c.JSON(http.StatusOK, gin.H{"data": tasks})
+				return
+			}
+		}
+	}
+
+	var tasks []models.TasksModel
+	if err := tasksListQuery(ownerID, filter).Order("`order` asc, id asc").Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No tasks found!"})
+		return
+	}
+
+	if err := attachCommentCounts(tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant count task comments!"})
+		return
+	}
+
+	if err := attachTaskDependencies(tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task dependencies!"})
 		return
 	}
 
-	if len(keys) > 0 {
-		initializers.RedisClient.Del(initializers.Ctx, keys...)
+	if genErr == nil {
+		go cacheTaskList(cacheKey, tasks)
 	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tasks})
 }
 
-func GetAllTasks(c *gin.Context) {
+// filters of tasks list from query params
+type tasksFilter struct {
+	//every condition of list, old boolean params are turned into query terms
+	Query utils.TaskQuery
+	//tasks deferred to the future are hidden unless this is set or query asks for them
+	ShowDeferred bool
+}
+
+// boolean params which came before query language, kept for old clients
+var legacyTaskFilters = []struct {
+	param string
+	terms string
+}{
+	{"hideCompleted", "-completed"},
+	{"showTodayOnly", "created:today"},
+	{"actionableOnly", "actionable"},
+	{"inbox", "inbox"},
+}
+
+// build filter from ?query=, ?smartList=<id> and old boolean params, all of them must match.
+// each of them is parsed on its own, so errors point at text where they are.
+// relative dates are days in time zone of user who looks at the list
+func tasksFilterFromQuery(c *gin.Context, ownerID uint) (tasksFilter, bool) {
+	var filter tasksFilter
+	filter.ShowDeferred = c.Query("showDeferred") == "true"
+
 	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	now := time.Now()
+	loc := user.(models.User).Location()
 
-	//get filter params from req
-	hideCompleted := c.Query("hideCompleted") == "true"
-	showTodayOnly := c.Query("showTodayOnly") == "true"
-
-	cacheKey := getTasksListCacheKey(currentUser.ID, hideCompleted, showTodayOnly)
-	cachedTasks, err := initializers.RedisClient.Get(initializers.Ctx, cacheKey).Result()
-	if err == nil {
-		// Found in cache
-		var tasks []models.TasksModel
-		if err := json.Unmarshal([]byte(cachedTasks), &tasks); err == nil {
-			c.JSON(http.StatusOK, gin.H{"data": tasks})
+	text := c.Query("query")
+	if !utils.IsValidTaskQueryLength(text) {
+		c.JSON(http.StatusBadRequest, gin.H{"queryError": "Query must be max " + strconv.Itoa(utils.TaskQueryMaxLength) + " characters!"})
+		return filter, false
+	}
+	query, err := utils.ParseTaskQuery(text, now, loc)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"queryError": err.Error()})
+		return filter, false
+	}
+
+	if c.Query("smartList") != "" {
+		smartListID, err := strconv.Atoi(c.Query("smartList"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong smart list id!"})
+			return filter, false
+		}
+		var smartList models.TaskSmartListModel
+		if err := initializers.DB.Where("id = ? AND user_id = ?", smartListID, ownerID).First(&smartList).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Smart list not found!"})
+			return filter, false
+		}
+		smartListQuery, err := utils.ParseTaskQuery(smartList.Query, now, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"queryError": "Smart list " + smartList.Name + ": " + err.Error()})
+			return filter, false
+		}
+		query.Terms = append(query.Terms, smartListQuery.Terms...)
+	}
+
+	for _, legacy := range legacyTaskFilters {
+		if c.Query(legacy.param) != "true" {
+			continue
+		}
+		legacyQuery, err := utils.ParseTaskQuery(legacy.terms, now, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"queryError": err.Error()})
+			return filter, false
+		}
+		query.Terms = append(query.Terms, legacyQuery.Terms...)
+	}
+	filter.Query = query
+
+	return filter, true
+}
+
+// part of cache key, query is hashed because it can be long and has any characters.
+// its dates are already resolved, so the key changes with day and zone
+func (f tasksFilter) cacheKey() string {
+	sum := sha1.Sum([]byte(f.Query.String()))
+	return fmt.Sprintf("q:%s:deferred:%t", hex.EncodeToString(sum[:]), f.ShowDeferred)
+}
+
+// value for LIKE which matches text anywhere, wildcards of text are escaped
+func containsPattern(text string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text) + "%"
+}
+
+// sql condition of one query term
+func taskQueryCondition(term utils.TaskQueryTerm, now time.Time) (string, []interface{}) {
+	switch term.Field {
+	case utils.TaskQueryText:
+		pattern := containsPattern(term.Text)
+		return "title LIKE ? OR description LIKE ?", []interface{}{pattern, pattern}
+	case utils.TaskQueryTag:
+		return "tags LIKE ?", []interface{}{models.TagPattern(term.Text)}
+	case utils.TaskQueryPriority:
+		return "priority " + term.Op + " ?", []interface{}{term.Number}
+	case utils.TaskQueryEstimate:
+		return "pomodoro_estimate " + term.Op + " ?", []interface{}{term.Number}
+	case utils.TaskQueryDue, utils.TaskQueryCreated:
+		column := "due_date"
+		if term.Field == utils.TaskQueryCreated {
+			column = "created_at"
+		}
+		if term.None {
+			return column + " IS NULL", nil
+		}
+		var conditions []string
+		var args []interface{}
+		if term.From != nil {
+			conditions = append(conditions, column+" >= ?")
+			args = append(args, *term.From)
+		}
+		if term.To != nil {
+			conditions = append(conditions, column+" < ?")
+			args = append(args, *term.To)
+		}
+		return strings.Join(conditions, " AND "), args
+	case utils.TaskQueryCompleted:
+		return "completed = ?", []interface{}{true}
+	case utils.TaskQueryBlocked:
+		return "NOT (" + actionableTaskCondition + ")", []interface{}{false}
+	case utils.TaskQueryActionable:
+		return "completed = ? AND " + actionableTaskCondition, []interface{}{false, false}
+	case utils.TaskQueryInbox:
+		return "inbox = ? AND completed = ? AND (" + visibleTaskCondition + ")", []interface{}{true, false, now}
+	case utils.TaskQueryDeferred:
+		return "defer_until > ?", []interface{}{now}
+	case utils.TaskQueryArchived:
+		return "archived_at IS NOT NULL", nil
+	}
+	return "", nil
+}
+
+// build query of users tasks with list filters applied
+func tasksListQuery(userID uint, filter tasksFilter) *gorm.DB {
+	now := time.Now()
+	query := initializers.DB.Model(&models.TasksModel{}).Where("user_id = ?", userID)
+
+	for _, term := range filter.Query.Terms {
+		condition, args := taskQueryCondition(term, now)
+		if condition == "" {
+			continue
+		}
+		if term.Negated {
+			//NULL column does not match, so negated term keeps such task
+			condition = "NOT COALESCE((" + condition + "), FALSE)"
+		} else {
+			condition = "(" + condition + ")"
+		}
+		query = query.Where(condition, args...)
+	}
+
+	if !filter.ShowDeferred && !filter.Query.Has(utils.TaskQueryDeferred) {
+		query = query.Where(visibleTaskCondition, now)
+	}
+
+	//archive is searched only when query asks for it
+	if !filter.Query.Has(utils.TaskQueryArchived) {
+		query = query.Where("archived_at IS NULL")
+	}
+
+	return query
+}
+
+// respond with one page of tasks, next page starts after returned cursor
+func getTasksPage(c *gin.Context, userID uint, filter tasksFilter) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(TasksPageDefaultSize)))
+	if err != nil || limit < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong page size!"})
+		return
+	}
+	if limit > TasksPageMaxSize {
+		limit = TasksPageMaxSize
+	}
+
+	cursorStr := c.Query("cursor")
+	var cursor tasksCursor
+	if cursorStr != "" {
+		if err := utils.DecodeCursor(cursorStr, &cursor); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong cursor!"})
 			return
 		}
+	}
+
+	withTotal := c.Query("withTotal") == "true"
 
+	generation, genErr := getTasksCacheGeneration(userID)
+	cacheKey := getTasksPageCacheKey(userID, generation, filter, cursorStr, limit, withTotal)
+
+	if genErr == nil {
+		cachedPage, err := initializers.RedisClient.Get(initializers.Ctx, cacheKey).Result()
+		if err == nil {
+			var page tasksPage
+			if err := json.Unmarshal([]byte(cachedPage), &page); err == nil {
+				respondTasksPage(c, page)
+				return
+			}
+		}
 	}
 
-	query := initializers.DB.Where("user_id = ?", currentUser.ID)
+	var page tasksPage
 
-	if hideCompleted {
-		query = query.Where("completed = ?", false)
+	if withTotal {
+		var total int64
+		if err := tasksListQuery(userID, filter).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant count tasks!"})
+			return
+		}
+		page.Total = &total
 	}
 
-	if showTodayOnly {
-		now := time.Now()
-		startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
-		endOfDay := startOfDay.Add(24 * time.Hour)
-		query = query.Where("created_at >= ? AND created_at < ?", startOfDay, endOfDay)
+	query := tasksListQuery(userID, filter)
+	if cursorStr != "" {
+		query = query.Where("(`order` > ?) OR (`order` = ? AND id > ?)", cursor.Order, cursor.Order, cursor.ID)
 	}
 
-	var tasks []models.TasksModel
-	if err := query.Order("\"order\" asc").Find(&tasks).Error; err != nil {
+	//fetch one extra row to know if there is next page
+	if err := query.Order("`order` asc, id asc").Limit(limit + 1).Find(&page.Tasks).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "No tasks found!"})
 		return
 	}
 
-	go cacheTaskList(currentUser.ID, hideCompleted, showTodayOnly, tasks)
+	if len(page.Tasks) > limit {
+		page.Tasks = page.Tasks[:limit]
+		last := page.Tasks[limit-1]
+		page.NextCursor = utils.EncodeCursor(tasksCursor{Order: last.Order, ID: last.ID})
+	}
+
+	if err := attachCommentCounts(page.Tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant count task comments!"})
+		return
+	}
+
+	if err := attachTaskDependencies(page.Tasks); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task dependencies!"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"data": tasks})
+	if genErr == nil {
+		go cacheTasksPage(cacheKey, page)
+	}
+
+	respondTasksPage(c, page)
+}
+
+func respondTasksPage(c *gin.Context, page tasksPage) {
+	response := gin.H{
+		"data":       page.Tasks,
+		"nextCursor": page.NextCursor,
+		"hasMore":    page.NextCursor != "",
+	}
+	if page.Total != nil {
+		response["total"] = *page.Total
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
 func CreateTask(c *gin.Context) {
-	//get authenticated user from ctx
-	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	//get owner of task list from ctx, it is set by RequireTaskAccess
+	ownerID := taskOwnerID(c)
 
 	var input struct {
 		Title       string `json:"title" binding:"required"`
@@ -116,46 +429,93 @@ func CreateTask(c *gin.Context) {
 		return
 	}
 
-	//get current user last localID value(if no tasks, localid = 0)
-	var lastTask models.TasksModel
-	initializers.DB.Where("user_id = ?", currentUser.ID).Order("local_id desc").First(&lastTask)
-	newLocalID := lastTask.LocalID + 1
+	var task models.TasksModel
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		task, err = createTask(tx, models.TasksModel{
+			UserID:      ownerID,
+			Title:       input.Title,
+			Description: input.Description,
+			Inbox:       true,
+		})
+		if err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, newTaskHistory(task, models.TaskActionCreated, "", task.Title))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant create a task!"})
+		return
+	}
 
-	//get the highest order value
-	var maxOrder int
-	result := initializers.DB.Model(&models.TasksModel{}).
-		Where("user_id = ?", currentUser.ID).
-		Select("COALESCE(MAX(`order`), 0)").
-		Scan(&maxOrder)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventCreated, []models.TasksModel{task})
 
-	if result.Error != nil {
-		maxOrder = 0
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// create task from one line like "Review PR tomorrow 5pm #work !high ~2",
+// due date is read in time zone of user who types it
+func QuickAddTask(c *gin.Context) {
+	user, _ := c.Get("user")
+	ownerID := taskOwnerID(c)
+
+	var input struct {
+		Text        string `json:"text" binding:"required"`
+		Description string `json:"description"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	newOrder := maxOrder + 1
+	parsed := utils.ParseQuickAdd(input.Text, time.Now(), user.(models.User).Location())
 
-	task := models.TasksModel{
-		UserID:      currentUser.ID,
-		LocalID:     newLocalID,
-		Title:       input.Title,
-		Description: input.Description,
-		Completed:   false,
-		Order:       newOrder,
+	if !utils.IsValidTitle(parsed.Title) {
+		c.JSON(http.StatusBadRequest, gin.H{"createTitleError": "Title must be between 2 and 95 characters!", "parsed": parsed})
+		return
 	}
 
-	if err := initializers.DB.Create(&task).Error; err != nil {
+	//quick-add line has no description, so it is checked only when sent
+	if input.Description != "" && !utils.IsValidDescription(input.Description) {
+		c.JSON(http.StatusBadRequest, gin.H{"createDescriptionError": "Description must be  between 2 and 870 characters!", "parsed": parsed})
+		return
+	}
+
+	var task models.TasksModel
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		task, err = createTask(tx, models.TasksModel{
+			UserID:           ownerID,
+			Title:            parsed.Title,
+			Description:      input.Description,
+			DueDate:          parsed.DueDate,
+			Tags:             parsed.Tags,
+			Priority:         parsed.Priority,
+			PomodoroEstimate: parsed.PomodoroEstimate,
+			Inbox:            true,
+		})
+		if err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, newTaskHistory(task, models.TaskActionCreated, "", task.Title))
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant create a task!"})
 		return
 	}
 
-	invalidateUserTaskCaches(currentUser.ID)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventCreated, []models.TasksModel{task})
 
-	c.JSON(http.StatusOK, gin.H{"data": task})
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"data": task, "parsed": parsed})
 }
 
 func UpdateTaskTitle(c *gin.Context) {
-	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
 
 	localTaskIDStr := c.Param("id")
 	localTaskID, err := strconv.Atoi(localTaskIDStr)
@@ -166,13 +526,19 @@ func UpdateTaskTitle(c *gin.Context) {
 
 	var task models.TasksModel
 
-	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, currentUser.ID).First(&task).Error; err != nil {
+	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, ownerID).First(&task).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task!"})
 		return
 	}
 
 	var input struct {
-		Title string `json:"title" binding:"required"`
+		Title   string `json:"title" binding:"required"`
+		Version *uint  `json:"version"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
 	if !utils.IsValidTitle(input.Title) {
@@ -180,26 +546,37 @@ func UpdateTaskTitle(c *gin.Context) {
 		return
 	}
 
-	if err := c.ShouldBindJSON(&input); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	version, ok := expectedTaskVersion(c, input.Version)
+	if !ok {
 		return
 	}
 
-	task.Title = input.Title
+	oldTitle := task.Title
 
-	if err := initializers.DB.Save(&task).Error; err != nil {
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateTaskVersioned(tx, &task, version, map[string]interface{}{"title": input.Title}); err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, newTaskHistory(task, models.TaskActionTitleChanged, oldTitle, task.Title))
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondTaskConflict(c, task.ID)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant update task title!"})
 		return
 	}
 
-	invalidateUserTaskCaches(currentUser.ID)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventUpdated, []models.TasksModel{task})
 
+	c.Header("ETag", taskETag(task))
 	c.JSON(http.StatusOK, gin.H{"data": task})
 }
 
 func UpdateTaskDescription(c *gin.Context) {
-	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
 
 	//get local task id from url param and convert to num
 	localTaskIDStr := c.Param("id")
@@ -211,13 +588,14 @@ func UpdateTaskDescription(c *gin.Context) {
 
 	var task models.TasksModel
 	//find task with local id and user id
-	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, currentUser.ID).First(&task).Error; err != nil {
+	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, ownerID).First(&task).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task!"})
 		return
 	}
 
 	var input struct {
 		Description string `json:"description" binding:"required"`
+		Version     *uint  `json:"version"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -230,22 +608,38 @@ func UpdateTaskDescription(c *gin.Context) {
 		return
 	}
 
-	task.Description = input.Description
+	version, ok := expectedTaskVersion(c, input.Version)
+	if !ok {
+		return
+	}
 
-	if err := initializers.DB.Save(&task).Error; err != nil {
+	oldDescription := task.Description
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateTaskVersioned(tx, &task, version, map[string]interface{}{"description": input.Description}); err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, newTaskHistory(task, models.TaskActionDescriptionChanged, oldDescription, task.Description))
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondTaskConflict(c, task.ID)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant update task description!"})
 		return
 	}
 
-	invalidateUserTaskCaches(currentUser.ID)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventUpdated, []models.TasksModel{task})
 
+	c.Header("ETag", taskETag(task))
 	c.JSON(http.StatusOK, gin.H{"data": task})
 
 }
 
 func CompleteTask(c *gin.Context) {
-	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
 
 	localTaskIDStr := c.Param("id")
 	localTaskID, err := strconv.Atoi(localTaskIDStr)
@@ -256,13 +650,14 @@ func CompleteTask(c *gin.Context) {
 
 	var task models.TasksModel
 
-	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, currentUser.ID).First(&task).Error; err != nil {
+	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, ownerID).First(&task).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task!"})
 		return
 	}
 
 	var input struct {
-		Completed bool `json:"completed" `
+		Completed bool  `json:"completed" `
+		Version   *uint `json:"version"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -270,21 +665,55 @@ func CompleteTask(c *gin.Context) {
 		return
 	}
 
-	task.Completed = input.Completed
+	version, ok := expectedTaskVersion(c, input.Version)
+	if !ok {
+		return
+	}
+
+	wasCompleted := task.Completed
+
+	action := models.TaskActionCompleted
+	if !input.Completed {
+		action = models.TaskActionUncompleted
+	}
 
-	if err := initializers.DB.Save(&task).Error; err != nil {
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		values := taskCompletionValues(task, input.Completed)
+		if err := addColumnCompletionUpdate(tx, task, input.Completed, values); err != nil {
+			return err
+		}
+		if err := updateTaskVersioned(tx, &task, version, values); err != nil {
+			return err
+		}
+		if wasCompleted == task.Completed {
+			return nil
+		}
+		if err := touchDependents(tx, task.ID); err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, newTaskHistory(task, action, strconv.FormatBool(wasCompleted), strconv.FormatBool(task.Completed)))
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondTaskConflict(c, task.ID)
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant complete task!"})
 		return
 	}
 
-	invalidateUserTaskCaches(currentUser.ID)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventCompleted, []models.TasksModel{task})
 
-	c.JSON(http.StatusOK, gin.H{"data": task})
+	//tasks waiting for this one got unblocked or blocked again
+	dependents := broadcastDependents(c, ownerID, task.ID)
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"data": task, "dependents": dependents})
 }
 
 func DeleteTask(c *gin.Context) {
-	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
 
 	localTaskIDStr := c.Param("id")
 	localTaskID, err := strconv.Atoi(localTaskIDStr)
@@ -295,64 +724,95 @@ func DeleteTask(c *gin.Context) {
 
 	var task models.TasksModel
 
-	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, currentUser.ID).First(&task).Error; err != nil {
+	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, ownerID).First(&task).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task!"})
 		return
 	}
 
-	//delete finded task
-	if err := initializers.DB.Unscoped().Delete(&task).Error; err != nil {
+	//move finded task to trash
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&task).Error; err != nil {
+			return err
+		}
+		if err := touchDependents(tx, task.ID); err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, newTaskHistory(task, models.TaskActionDeleted, "", ""))
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete task!"})
 		return
 	}
 
-	invalidateUserTaskCaches(currentUser.ID)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTasksDeleted(c, ownerID, []models.TasksModel{task})
+	broadcastDependents(c, ownerID, task.ID)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Task successfully deleted!"})
+	c.JSON(http.StatusOK, gin.H{"message": "Task moved to trash!"})
 }
 
 func DeleteAllTasks(c *gin.Context) {
-	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
 
-	if err := initializers.DB.Unscoped().Where("user_id = ?", currentUser.ID).Delete(&models.TasksModel{}).Error; err != nil {
+	var tasks []models.TasksModel
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", ownerID).Find(&tasks).Error; err != nil {
+			return err
+		}
+		return trashTasks(tx, tasks)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete all tasks!"})
 		return
 	}
 
-	invalidateUserTaskCaches(currentUser.ID)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTasksDeleted(c, ownerID, tasks)
+	broadcastDependents(c, ownerID, taskIDs(tasks)...)
 
-	c.JSON(http.StatusOK, gin.H{"message": "All tasks successfully deleted!"})
+	c.JSON(http.StatusOK, gin.H{"message": "All tasks moved to trash!"})
 }
 
+// trash completed tasks shown in list, archive is left as it is
 func DeleteAllCompletedTasks(c *gin.Context) {
-	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
 
-	result := initializers.DB.Unscoped().Where("user_id = ? AND completed = ?", currentUser.ID, true).Delete(&models.TasksModel{})
+	var tasks []models.TasksModel
+	var count int
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND completed = ? AND archived_at IS NULL", ownerID, true).Find(&tasks).Error; err != nil {
+			return err
+		}
+		count = len(tasks)
+		return trashTasks(tx, tasks)
+	})
 
-	if result.Error != nil {
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete all completed tasks!"})
 		return
 	}
 
-	if result.RowsAffected == 0 {
+	if count == 0 {
 		c.JSON(http.StatusOK, gin.H{"message": "No completed tasks to delete"})
 		return
 	}
 
-	invalidateUserTaskCaches(currentUser.ID)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTasksDeleted(c, ownerID, tasks)
+	broadcastDependents(c, ownerID, taskIDs(tasks)...)
 
-	c.JSON(http.StatusOK, gin.H{"message": "All completed tasks successfully deleted!", "count": result.RowsAffected})
+	c.JSON(http.StatusOK, gin.H{"message": "All completed tasks moved to trash!", "count": count})
 }
 
+// set order of many tasks at once, MoveTask should be used to move one task
 func UpdateTasksOrder(c *gin.Context) {
-	user, _ := c.Get("user")
-	currentUser := user.(models.User)
+	ownerID := taskOwnerID(c)
 
+	//every item carries version of the task it was moved from. order is a pointer, 0 is a valid key
 	var input []struct {
-		LocalID int `json:"localId" binding:"required"`
-		Order   int `json:"order" binding:"required"`
+		LocalID int      `json:"localId" binding:"required"`
+		Order   *float64 `json:"order"`
+		Version *uint    `json:"version"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -360,21 +820,189 @@ func UpdateTasksOrder(c *gin.Context) {
 		return
 	}
 
+	for _, item := range input {
+		if item.Order == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Every moved task must have an order!"})
+			return
+		}
+		if item.Version == nil {
+			c.JSON(http.StatusPreconditionRequired, gin.H{"error": "Every moved task must have a version!"})
+			return
+		}
+	}
+
 	tx := initializers.DB.Begin()
 
+	var history []models.TaskHistoryModel
+	var updated []models.TasksModel
+	var conflicts []uint
 	for _, item := range input {
-		if err := tx.Model(&models.TasksModel{}).
-			Where("local_id = ? AND user_id = ?", item.LocalID, currentUser.ID).
-			Update("order", item.Order).Error; err != nil {
+		var task models.TasksModel
+		if err := tx.Where("local_id = ? AND user_id = ?", item.LocalID, ownerID).First(&task).Error; err != nil {
+			continue
+		}
+
+		if task.Order == *item.Order {
+			continue
+		}
+
+		oldPosition, err := taskPositionValue(tx, task.ID)
+		if err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot update tasks order!"})
 			return
 		}
+		err = updateTaskVersioned(tx, &task, *item.Version, map[string]interface{}{"order": *item.Order})
+		if errors.Is(err, errTaskVersionConflict) {
+			//collect all stale tasks, so client can refresh them at once
+			conflicts = append(conflicts, task.ID)
+			continue
+		}
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot update tasks order!"})
+			return
+		}
+
+		updated = append(updated, task)
+		history = append(history, newTaskHistory(task, models.TaskActionReordered, oldPosition, formatTaskOrder(*item.Order)))
+	}
+
+	if len(conflicts) > 0 {
+		tx.Rollback()
+
+		var current []models.TasksModel
+		initializers.DB.Where("id IN ?", conflicts).Find(&current)
+		c.JSON(http.StatusConflict, gin.H{"error": "Some tasks were changed by someone else!", "data": current})
+		return
+	}
+
+	if err := recordTaskHistory(tx, history...); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot update tasks order!"})
+		return
 	}
 
 	tx.Commit()
 
-	invalidateUserTaskCaches(currentUser.ID)
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventReordered, updated)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tasks order updated successfully!", "data": updated})
+}
+
+// move tasks to trash and record it as one history group
+func trashTasks(tx *gorm.DB, tasks []models.TasksModel) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(tasks))
+	history := make([]models.TaskHistoryModel, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+		history = append(history, newTaskHistory(task, models.TaskActionDeleted, "", ""))
+	}
+
+	if err := tx.Where("id IN ?", ids).Delete(&models.TasksModel{}).Error; err != nil {
+		return err
+	}
+	if err := touchDependents(tx, ids...); err != nil {
+		return err
+	}
+
+	return recordTaskHistory(tx, history...)
+}
+
+// insert a new task at the end of users list, localID and order are assigned here
+func createTask(tx *gorm.DB, task models.TasksModel) (models.TasksModel, error) {
+	userID := task.UserID
+
+	//take next localID from users counter, it never goes back, so a purged task does not give
+	//its localID to a new one and tombstones in sync stay unambiguous. trashed tasks and tombstones
+	//are counted for users who had tasks before the counter existed. the update also locks user row,
+	//so parallel creates get different ids
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).
+		UpdateColumn("last_task_local_id", gorm.Expr("GREATEST(last_task_local_id, "+
+			"(SELECT COALESCE(MAX(local_id), 0) FROM tasks_models WHERE user_id = ?), "+
+			"(SELECT COALESCE(MAX(local_id), 0) FROM task_tombstone_models WHERE user_id = ?)) + 1", userID, userID)).Error; err != nil {
+		return task, err
+	}
+	var newLocalID uint
+	if err := tx.Model(&models.User{}).Where("id = ?", userID).Select("last_task_local_id").Scan(&newLocalID).Error; err != nil {
+		return task, err
+	}
+
+	//get the highest order value, new task goes one step after it
+	var maxOrder float64
+	result := tx.Model(&models.TasksModel{}).
+		Where("user_id = ?", userID).
+		Select("COALESCE(MAX(`order`), 0)").
+		Scan(&maxOrder)
+
+	if result.Error != nil {
+		maxOrder = 0
+	}
+
+	newOrder := maxOrder + TaskOrderStep
+
+	task.LocalID = newLocalID
+	task.Order = newOrder
+
+	err := tx.Create(&task).Error
+	return task, err
+}
+
+var errTaskVersionConflict = errors.New("task version conflict")
+
+// strong etag of current task version
+func taskETag(task models.TasksModel) string {
+	return `"` + strconv.FormatUint(uint64(task.Version), 10) + `"`
+}
+
+// version client based its change on, from If-Match header or version field of body
+func expectedTaskVersion(c *gin.Context, bodyVersion *uint) (uint, bool) {
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		tag := strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`)
+		version, err := strconv.ParseUint(tag, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong If-Match header!"})
+			return 0, false
+		}
+		return uint(version), true
+	}
+
+	if bodyVersion != nil {
+		return *bodyVersion, true
+	}
+
+	c.JSON(http.StatusPreconditionRequired, gin.H{"error": "Task version is required, send If-Match header or version!"})
+	return 0, false
+}
+
+// update task only if nobody changed it since version, task is reloaded after
+func updateTaskVersioned(tx *gorm.DB, task *models.TasksModel, version uint, values map[string]interface{}) error {
+	values["version"] = gorm.Expr("version + 1")
+
+	result := tx.Model(&models.TasksModel{}).Where("id = ? AND version = ?", task.ID, version).Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errTaskVersionConflict
+	}
+
+	return tx.First(task, task.ID).Error
+}
+
+// respond with server copy of task, so client can merge or retry
+func respondTaskConflict(c *gin.Context, taskID uint) {
+	var current models.TasksModel
+	if err := initializers.DB.First(&current, taskID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task!"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Tasks order updated successfully!"})
+	c.Header("ETag", taskETag(current))
+	c.JSON(http.StatusConflict, gin.H{"error": "Task was changed by someone else!", "data": current})
 }
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/utils"
+	"time"
+)
+
+const DeferredTasksCheckInterval = 30 * time.Second
+
+// condition which hides tasks deferred to the future, use with tasks_models query
+const visibleTaskCondition = "defer_until IS NULL OR defer_until <= ?"
+
+func formatDeferUntil(until *time.Time) string {
+	if until == nil {
+		return ""
+	}
+	return until.UTC().Format(time.RFC3339)
+}
+
+// hide task until given moment, nil shows it again. deciding when to do task triages it
+func setTaskDeferral(c *gin.Context, ownerID uint, task models.TasksModel, until *time.Time, version uint) {
+	old := task
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateTaskVersioned(tx, &task, version, map[string]interface{}{
+			"defer_until": until,
+			"inbox":       false,
+		}); err != nil {
+			return err
+		}
+
+		var history []models.TaskHistoryModel
+		if formatDeferUntil(old.DeferUntil) != formatDeferUntil(task.DeferUntil) {
+			history = append(history, newTaskHistory(task, models.TaskActionDeferred, formatDeferUntil(old.DeferUntil), formatDeferUntil(task.DeferUntil)))
+		}
+		if old.Inbox {
+			history = append(history, newTaskHistory(task, models.TaskActionTriaged, "true", "false"))
+		}
+		return recordTaskHistory(tx, history...)
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondTaskConflict(c, task.ID)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant defer task!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+
+	//for other sessions deferred task leaves the list and comes back when its time arrives
+	if task.DeferUntil != nil && task.DeferUntil.After(time.Now()) {
+		broadcastTasksDeleted(c, ownerID, []models.TasksModel{task})
+	} else {
+		broadcastTaskEvent(c, ownerID, TaskEventUpdated, []models.TasksModel{task})
+	}
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// set start date of task, {"until": null} clears it
+func DeferTask(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Until   *time.Time `json:"until"`
+		Version *uint      `json:"version"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	version, ok := expectedTaskVersion(c, input.Version)
+	if !ok {
+		return
+	}
+
+	setTaskDeferral(c, ownerID, task, input.Until, version)
+}
+
+// hide task for one of presets: later_today, tomorrow or next_week
+func SnoozeTask(c *gin.Context) {
+	user, _ := c.Get("user")
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Preset  string `json:"preset" binding:"required"`
+		Version *uint  `json:"version"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	until, ok := utils.SnoozeUntil(input.Preset, time.Now(), user.(models.User).Location())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown snooze preset!"})
+		return
+	}
+
+	version, ok := expectedTaskVersion(c, input.Version)
+	if !ok {
+		return
+	}
+
+	setTaskDeferral(c, ownerID, task, &until, version)
+}
+
+// take task out of inbox, it stays in list as usual
+func TriageTask(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	task, ok := findListTask(c, ownerID)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Version *uint `json:"version"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	version, ok := expectedTaskVersion(c, input.Version)
+	if !ok {
+		return
+	}
+
+	if !task.Inbox {
+		c.Header("ETag", taskETag(task))
+		c.JSON(http.StatusOK, gin.H{"data": task})
+		return
+	}
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := updateTaskVersioned(tx, &task, version, map[string]interface{}{"inbox": false}); err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, newTaskHistory(task, models.TaskActionTriaged, "true", "false"))
+	})
+	if errors.Is(err, errTaskVersionConflict) {
+		respondTaskConflict(c, task.ID)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant triage task!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventUpdated, []models.TasksModel{task})
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// tasks whose defer date passed are shown again, their defer date is cleared and version bumped,
+// so delta sync picks them up. cached lists are dropped and open sessions get them back.
+// only stored rows are checked, so tasks which came due while server was down are revealed too
+func RevealDeferredTasks(now time.Time) (int, error) {
+	var ids []uint
+	if err := initializers.DB.Model(&models.TasksModel{}).
+		Where("defer_until IS NOT NULL AND defer_until <= ?", now).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if err := initializers.DB.Model(&models.TasksModel{}).
+		Where("id IN ? AND defer_until <= ?", ids, now).
+		Updates(map[string]interface{}{
+			"defer_until": nil,
+			"version":     gorm.Expr("version + 1"),
+		}).Error; err != nil {
+		return 0, err
+	}
+
+	var tasks []models.TasksModel
+	if err := initializers.DB.Where("id IN ?", ids).Order("`order` asc, id asc").Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+	if err := attachCommentCounts(tasks); err != nil {
+		return 0, err
+	}
+	if err := attachTaskDependencies(tasks); err != nil {
+		return 0, err
+	}
+
+	byOwner := make(map[uint][]models.TasksModel)
+	for _, task := range tasks {
+		byOwner[task.UserID] = append(byOwner[task.UserID], task)
+	}
+	for ownerID, ownerTasks := range byOwner {
+		invalidateUserTaskCaches(ownerID)
+		taskEvents.publish(ownerID, TaskEvent{Type: TaskEventCreated, Tasks: ownerTasks})
+	}
+
+	return len(tasks), nil
+}
+
+func StartDeferredTasksWatcher() {
+	go func() {
+		ticker := time.NewTicker(DeferredTasksCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			count, err := RevealDeferredTasks(time.Now())
+			if err != nil {
+				log.Printf("Failed to reveal deferred tasks: %v", err)
+			} else if count > 0 {
+				log.Printf("Revealed %d deferred tasks", count)
+			}
+			<-ticker.C
+		}
+	}()
+}
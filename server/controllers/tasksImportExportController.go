@@ -0,0 +1,271 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/utils"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	TasksImportMaxSize = 5 << 20
+	TasksImportMaxRows = 1000
+	TasksExportBatch   = 500
+)
+
+// stream all users tasks in requested format
+func ExportTasks(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	format := c.Param("format")
+	contentType, extension, err := utils.TaskFormatFile(format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown export format!"})
+		return
+	}
+
+	query := initializers.DB.Where("user_id = ?", ownerID)
+	if c.Query("hideCompleted") == "true" {
+		query = query.Where("completed = ?", false)
+	}
+
+	user, _ := c.Get("user")
+	filename := fmt.Sprintf("tasks-%s.%s", time.Now().In(user.(models.User).Location()).Format("2006-01-02"), extension)
+	c.Header("Content-Type", contentType+"; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	writer, err := utils.NewTaskWriter(format, c.Writer)
+	if err != nil {
+		log.Printf("Failed to start tasks export for user %d: %v", ownerID, err)
+		return
+	}
+
+	var tasks []models.TasksModel
+	result := query.Order("`order` asc, id asc").FindInBatches(&tasks, TasksExportBatch, func(tx *gorm.DB, batch int) error {
+		for _, task := range tasks {
+			if err := writer.WriteTask(task); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if result.Error != nil {
+		log.Printf("Failed to export tasks for user %d: %v", ownerID, result.Error)
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		log.Printf("Failed to finish tasks export for user %d: %v", ownerID, err)
+	}
+}
+
+// read uploaded file, from multipart "file" field or from raw body
+func readImportFile(c *gin.Context) ([]byte, error) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, TasksImportMaxSize)
+
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return nil, err
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return io.ReadAll(file)
+	}
+
+	return io.ReadAll(c.Request.Body)
+}
+
+// check imported tasks like CreateTask does, invalid rows are reported back
+func validateImportedTasks(userID uint, imported []utils.ImportedTask) ([]models.TasksModel, []utils.ImportRowError) {
+	var tasks []models.TasksModel
+	var rowErrors []utils.ImportRowError
+
+	for _, item := range imported {
+		if !utils.IsValidTitle(item.Title) {
+			rowErrors = append(rowErrors, utils.ImportRowError{Row: item.Row, Error: "Title must be between 2 and 95 characters!"})
+			continue
+		}
+
+		//imported formats may have no description at all, so only filled ones are checked
+		if item.Description != "" && !utils.IsValidDescription(item.Description) {
+			rowErrors = append(rowErrors, utils.ImportRowError{Row: item.Row, Error: "Description must be  between 2 and 870 characters!"})
+			continue
+		}
+
+		if item.Priority > models.TaskPriorityHigh {
+			rowErrors = append(rowErrors, utils.ImportRowError{Row: item.Row, Error: "Unknown priority!"})
+			continue
+		}
+
+		if item.Estimate > utils.QuickAddMaxEstimate {
+			rowErrors = append(rowErrors, utils.ImportRowError{Row: item.Row, Error: fmt.Sprintf("Estimate must be max %d pomodoros!", utils.QuickAddMaxEstimate)})
+			continue
+		}
+
+		//completed task keeps moment from file, so archive policy counts from it
+		var completedAt *time.Time
+		if item.Completed {
+			completedAt = item.CompletedAt
+			if completedAt == nil {
+				now := time.Now()
+				completedAt = &now
+			}
+		}
+
+		tasks = append(tasks, models.TasksModel{
+			UserID:           userID,
+			Title:            item.Title,
+			Description:      item.Description,
+			Completed:        item.Completed,
+			CompletedAt:      completedAt,
+			DueDate:          item.DueDate,
+			Tags:             models.NormalizeTags(item.Tags),
+			Priority:         item.Priority,
+			PomodoroEstimate: item.Estimate,
+			Order:            item.Order,
+		})
+	}
+
+	return tasks, rowErrors
+}
+
+// create tasks in one transaction, import can be undone as one change.
+// tasks go after existing ones, order from file only keeps their positions among themselves
+func createImportedTasks(tasks []models.TasksModel) ([]models.TasksModel, error) {
+	created := make([]models.TasksModel, 0, len(tasks))
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].Order < tasks[j].Order
+	})
+
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		history := make([]models.TaskHistoryModel, 0, len(tasks))
+		for _, task := range tasks {
+			//like any new task it waits in inbox until it is triaged
+			task.Inbox = true
+			task, err := createTask(tx, task)
+			if err != nil {
+				return err
+			}
+			created = append(created, task)
+			history = append(history, newTaskHistory(task, models.TaskActionCreated, "", task.Title))
+		}
+		return recordTaskHistory(tx, history...)
+	})
+
+	return created, err
+}
+
+func ImportTasks(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	format := c.Param("format")
+	if _, _, err := utils.TaskFormatFile(format); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown import format!"})
+		return
+	}
+
+	data, err := readImportFile(c)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import file is too large!"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read import file"})
+		return
+	}
+
+	imported, rowErrors, err := utils.ParseTasks(format, bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cant parse import file: " + err.Error()})
+		return
+	}
+
+	saveImportedTasks(c, ownerID, imported, rowErrors)
+}
+
+// import export file of Todoist or Trello
+func ImportExternalTasks(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	source := c.Param("source")
+	if source != utils.TaskSourceTodoist && source != utils.TaskSourceTrello {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown import source!"})
+		return
+	}
+
+	data, err := readImportFile(c)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import file is too large!"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read import file"})
+		return
+	}
+
+	imported, rowErrors, err := utils.ParseExternalTasks(source, bytes.NewReader(data))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cant parse import file: " + err.Error()})
+		return
+	}
+
+	saveImportedTasks(c, ownerID, imported, rowErrors)
+}
+
+// validate and create parsed tasks, with dryRun=true only preview is returned
+func saveImportedTasks(c *gin.Context, userID uint, imported []utils.ImportedTask, rowErrors []utils.ImportRowError) {
+	if len(imported) > TasksImportMaxRows {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Too many tasks in file, max is %d!", TasksImportMaxRows)})
+		return
+	}
+
+	tasks, invalidRows := validateImportedTasks(userID, imported)
+	rowErrors = append(rowErrors, invalidRows...)
+
+	if c.Query("dryRun") == "true" {
+		c.JSON(http.StatusOK, gin.H{
+			"data":        tasks,
+			"imported":    0,
+			"wouldImport": len(tasks),
+			"errors":      rowErrors,
+			"dryRun":      true,
+		})
+		return
+	}
+
+	created, err := createImportedTasks(tasks)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant import tasks!"})
+		return
+	}
+
+	if len(created) > 0 {
+		invalidateUserTaskCaches(userID)
+		broadcastTaskEvent(c, userID, TaskEventCreated, created)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":     created,
+		"imported": len(created),
+		"errors":   rowErrors,
+	})
+}
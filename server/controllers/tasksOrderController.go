@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//distance between keys of renumbered list and of tasks added to its edges
+	TaskOrderStep = 1024.0
+
+	//gap smaller than this makes list wait for background renumbering
+	TaskOrderRebalanceGap = 1e-6
+
+	TaskOrderRebalanceKey      = "tasks:rebalance"
+	TaskOrderRebalanceInterval = 10 * time.Minute
+)
+
+var (
+	errTaskOrderConflict  = errors.New("task neighbours are out of order")
+	errTaskOrderNeighbour = errors.New("task neighbour not found")
+)
+
+func formatTaskOrder(order float64) string {
+	return strconv.FormatFloat(order, 'f', -1, 64)
+}
+
+// position of task before it is moved, stored as old value of reorder history: "order|after|before".
+// after and before are local ids of its neighbours, 0 is edge of the list. renumbering changes orders
+// but not neighbours, so undo puts task back between them
+func taskPositionValue(tx *gorm.DB, taskID uint) (string, error) {
+	var task models.TasksModel
+	if err := tx.First(&task, taskID).Error; err != nil {
+		return "", err
+	}
+
+	var after, before models.TasksModel
+	if err := tx.Where("user_id = ? AND (`order` < ? OR (`order` = ? AND id < ?))", task.UserID, task.Order, task.Order, task.ID).
+		Order("`order` desc, id desc").Limit(1).Find(&after).Error; err != nil {
+		return "", err
+	}
+	if err := tx.Where("user_id = ? AND (`order` > ? OR (`order` = ? AND id > ?))", task.UserID, task.Order, task.Order, task.ID).
+		Order("`order` asc, id asc").Limit(1).Find(&before).Error; err != nil {
+		return "", err
+	}
+
+	return formatTaskOrder(task.Order) + "|" + strconv.FormatUint(uint64(after.LocalID), 10) + "|" + strconv.FormatUint(uint64(before.LocalID), 10), nil
+}
+
+// order which puts task back to position from history, entries without neighbours have only order
+func restoredTaskOrder(tx *gorm.DB, task models.TasksModel, value string) (float64, bool, error) {
+	parts := strings.Split(value, "|")
+	order, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil || len(parts) != 3 {
+		return order, false, err
+	}
+
+	var neighbours [2]*uint
+	for i, part := range parts[1:] {
+		localID, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return order, false, err
+		}
+		if localID != 0 {
+			id := uint(localID)
+			neighbours[i] = &id
+		}
+	}
+	if neighbours[0] == nil && neighbours[1] == nil {
+		return order, false, nil
+	}
+
+	between, renumbered, err := taskOrderBetween(tx, task.UserID, task.ID, neighbours[0], neighbours[1])
+	if errors.Is(err, errTaskOrderNeighbour) || errors.Is(err, errTaskOrderConflict) {
+		//neighbours are gone or moved apart, old order is the best guess left
+		return order, false, nil
+	}
+	return between, renumbered, err
+}
+
+// key in the middle of gap, false if float precision has no room left
+func midTaskOrder(low *float64, high *float64) (float64, bool) {
+	switch {
+	case low == nil && high == nil:
+		return TaskOrderStep, true
+	case low == nil:
+		return *high - TaskOrderStep, true
+	case high == nil:
+		return *low + TaskOrderStep, true
+	}
+
+	mid := *low + (*high-*low)/2
+	return mid, mid > *low && mid < *high
+}
+
+// orders of tasks the moved one goes between, missing side is taken from the list
+func neighbourTaskOrders(tx *gorm.DB, userID uint, taskID uint, afterID *uint, beforeID *uint) (*float64, *float64, error) {
+	var after, before models.TasksModel
+
+	if afterID != nil {
+		if err := tx.Where("local_id = ? AND user_id = ?", *afterID, userID).First(&after).Error; err != nil {
+			return nil, nil, errTaskOrderNeighbour
+		}
+	}
+	if beforeID != nil {
+		if err := tx.Where("local_id = ? AND user_id = ?", *beforeID, userID).First(&before).Error; err != nil {
+			return nil, nil, errTaskOrderNeighbour
+		}
+	}
+
+	if afterID != nil && beforeID == nil {
+		tx.Where("user_id = ? AND id <> ? AND `order` >= ? AND id <> ?", userID, taskID, after.Order, after.ID).
+			Order("`order` asc, id asc").Limit(1).Find(&before)
+	}
+	if beforeID != nil && afterID == nil {
+		tx.Where("user_id = ? AND id <> ? AND `order` <= ? AND id <> ?", userID, taskID, before.Order, before.ID).
+			Order("`order` desc, id desc").Limit(1).Find(&after)
+	}
+
+	var low, high *float64
+	if after.ID != 0 {
+		low = &after.Order
+	}
+	if before.ID != 0 {
+		high = &before.Order
+	}
+
+	if low != nil && high != nil && *low > *high {
+		return nil, nil, errTaskOrderConflict
+	}
+	return low, high, nil
+}
+
+// order key which puts task between after and before, nil neighbour means edge of the list.
+// true means whole list was renumbered to make room, caller sends it with publishRebalancedOrder after commit
+func taskOrderBetween(tx *gorm.DB, userID uint, taskID uint, afterID *uint, beforeID *uint) (float64, bool, error) {
+	for attempt := 0; ; attempt++ {
+		low, high, err := neighbourTaskOrders(tx, userID, taskID, afterID, beforeID)
+		if err != nil {
+			return 0, false, err
+		}
+
+		order, ok := midTaskOrder(low, high)
+		if ok {
+			if low != nil && high != nil && *high-*low < TaskOrderRebalanceGap {
+				scheduleTaskOrderRebalance(userID)
+			}
+			return order, attempt > 0, nil
+		}
+
+		if attempt > 0 {
+			return 0, false, errTaskOrderConflict
+		}
+
+		//no room left between neighbours, renumber the list right now
+		if err := rebalanceTaskOrder(tx, userID); err != nil {
+			return 0, false, err
+		}
+	}
+}
+
+// renumber users list with even steps, relative order stays the same
+// so versions are not bumped and reorder history, which keeps neighbours, still undoes right.
+// updated_at is touched so sync picks new orders up
+func rebalanceTaskOrder(tx *gorm.DB, userID uint) error {
+	var ids []uint
+	if err := tx.Model(&models.TasksModel{}).
+		Where("user_id = ?", userID).
+		Order("`order` asc, id asc").
+		Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i, id := range ids {
+		if err := tx.Model(&models.TasksModel{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+			"order":      float64(i+1) * TaskOrderStep,
+			"updated_at": now,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scheduleTaskOrderRebalance(userID uint) {
+	initializers.RedisClient.SAdd(initializers.Ctx, TaskOrderRebalanceKey, userID)
+}
+
+// renumber lists which got too dense since last run
+func RebalanceScheduledTaskOrders() (int, error) {
+	count := 0
+	for {
+		userIDStr, err := initializers.RedisClient.SPop(initializers.Ctx, TaskOrderRebalanceKey).Result()
+		if err != nil {
+			//redis.Nil when set is empty
+			return count, nil
+		}
+
+		userID, err := strconv.ParseUint(userIDStr, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		if err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+			return rebalanceTaskOrder(tx, uint(userID))
+		}); err != nil {
+			return count, err
+		}
+
+		invalidateUserTaskCaches(uint(userID))
+		publishRebalancedOrder(uint(userID))
+		count++
+	}
+}
+
+func StartTaskOrderRebalancer() {
+	go func() {
+		ticker := time.NewTicker(TaskOrderRebalanceInterval)
+		defer ticker.Stop()
+
+		for {
+			<-ticker.C
+			count, err := RebalanceScheduledTaskOrders()
+			if err != nil {
+				log.Printf("Failed to rebalance tasks order: %v", err)
+			} else if count > 0 {
+				log.Printf("Rebalanced order of %d task lists", count)
+			}
+		}
+	}()
+}
+
+// move one task between two others, only moved task is updated
+func MoveTask(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	localTaskIDStr := c.Param("id")
+	localTaskID, err := strconv.Atoi(localTaskIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong task id!"})
+		return
+	}
+
+	var task models.TasksModel
+	if err := initializers.DB.Where("local_id = ? AND user_id = ?", localTaskID, ownerID).First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task!"})
+		return
+	}
+
+	//localIds of tasks which will be above and below moved one
+	var input struct {
+		After   *uint `json:"after"`
+		Before  *uint `json:"before"`
+		Version *uint `json:"version"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.After == nil && input.Before == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Send task to move after or before!"})
+		return
+	}
+
+	if (input.After != nil && *input.After == task.LocalID) || (input.Before != nil && *input.Before == task.LocalID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Task cant be moved next to itself!"})
+		return
+	}
+
+	version, ok := expectedTaskVersion(c, input.Version)
+	if !ok {
+		return
+	}
+
+	var renumbered bool
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var order float64
+		var err error
+		order, renumbered, err = taskOrderBetween(tx, ownerID, task.ID, input.After, input.Before)
+		if err != nil {
+			return err
+		}
+		oldPosition, err := taskPositionValue(tx, task.ID)
+		if err != nil {
+			return err
+		}
+		if err := updateTaskVersioned(tx, &task, version, map[string]interface{}{"order": order}); err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, newTaskHistory(task, models.TaskActionReordered, oldPosition, formatTaskOrder(order)))
+	})
+	switch {
+	case errors.Is(err, errTaskVersionConflict):
+		respondTaskConflict(c, task.ID)
+		return
+	case errors.Is(err, errTaskOrderNeighbour):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a neighbour task!"})
+		return
+	case errors.Is(err, errTaskOrderConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Tasks order was changed, reload the list!"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot move task!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventReordered, []models.TasksModel{task})
+	if renumbered {
+		publishRebalancedOrder(ownerID)
+	}
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
@@ -0,0 +1,88 @@
+package controllers
+
+import (
+	"math"
+	"server/models"
+	"testing"
+)
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func TestMidTaskOrder(t *testing.T) {
+	tests := []struct {
+		name   string
+		low    *float64
+		high   *float64
+		want   float64
+		wantOk bool
+	}{
+		{"empty list", nil, nil, TaskOrderStep, true},
+		{"top of list", nil, floatPtr(1024), 0, true},
+		{"bottom of list", floatPtr(2048), nil, 2048 + TaskOrderStep, true},
+		{"between", floatPtr(1024), floatPtr(2048), 1536, true},
+		{"negative keys", floatPtr(-2048), floatPtr(-1024), -1536, true},
+		{"equal neighbours", floatPtr(1024), floatPtr(1024), 1024, false},
+		{"adjacent floats", floatPtr(1024), floatPtr(math.Nextafter(1024, 2048)), 1024, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := midTaskOrder(tt.low, tt.high)
+			if ok != tt.wantOk {
+				t.Fatalf("midTaskOrder() ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && got != tt.want {
+				t.Errorf("midTaskOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// moving task again and again to the same gap must end with "no room", never with key outside of gap
+func TestMidTaskOrderExhaustsGap(t *testing.T) {
+	low, high := 1024.0, 2048.0
+	for i := 0; i < 100; i++ {
+		mid, ok := midTaskOrder(&low, &high)
+		if !ok {
+			if i < 40 {
+				t.Fatalf("gap exhausted after %d moves, expected about 50", i)
+			}
+			return
+		}
+		if mid <= low || mid >= high {
+			t.Fatalf("move %d: key %v is outside of gap (%v, %v)", i, mid, low, high)
+		}
+		high = mid
+	}
+	t.Fatal("gap was never exhausted")
+}
+
+func TestRestoredTaskOrderWithoutNeighbours(t *testing.T) {
+	tests := []struct {
+		value string
+		want  float64
+	}{
+		{"1536", 1536},
+		{"1536|0|0", 1536},
+		{"0.5", 0.5},
+	}
+
+	for _, tt := range tests {
+		//without neighbours database is not touched
+		got, _, err := restoredTaskOrder(nil, models.TasksModel{}, tt.value)
+		if err != nil {
+			t.Fatalf("restoredTaskOrder(%q) error = %v", tt.value, err)
+		}
+		if got != tt.want {
+			t.Errorf("restoredTaskOrder(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"", "abc", "1536|x|0"} {
+		if _, _, err := restoredTaskOrder(nil, models.TasksModel{}, value); err == nil {
+			t.Errorf("restoredTaskOrder(%q) expected error", value)
+		}
+	}
+}
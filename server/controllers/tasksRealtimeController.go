@@ -0,0 +1,264 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// types of events sent to open sessions of a task list
+const (
+	TaskEventCreated   = "created"
+	TaskEventUpdated   = "updated"
+	TaskEventCompleted = "completed"
+	TaskEventReordered = "reordered"
+	TaskEventDeleted   = "deleted"
+)
+
+const (
+	taskEventsBufferSize = 64
+	taskEventsPingPeriod = 30 * time.Second
+	taskEventsWriteWait  = 10 * time.Second
+)
+
+// header with id of browser tab which made the change, it comes back as Origin
+// so tab can skip events of its own requests
+const TaskClientIDHeader = "X-Client-ID"
+
+// change of task list. Tasks are full current copies which replace local ones
+// unless local Version is newer, LocalIDs are tasks which left the list
+type TaskEvent struct {
+	Type     string              `json:"type"`
+	Tasks    []models.TasksModel `json:"tasks,omitempty"`
+	LocalIDs []uint              `json:"localIds,omitempty"`
+	Origin   string              `json:"origin,omitempty"`
+}
+
+// one open websocket of a task list
+type taskSubscriber struct {
+	ws   *websocket.Conn
+	send chan TaskEvent
+}
+
+// open sessions grouped by owner of task list they watch
+type taskEventsHub struct {
+	subscribers map[uint]map[*taskSubscriber]bool
+	mx          sync.Mutex
+}
+
+var taskEvents = taskEventsHub{
+	subscribers: make(map[uint]map[*taskSubscriber]bool),
+}
+
+func (h *taskEventsHub) subscribe(ownerID uint, s *taskSubscriber) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if h.subscribers[ownerID] == nil {
+		h.subscribers[ownerID] = make(map[*taskSubscriber]bool)
+	}
+	h.subscribers[ownerID][s] = true
+}
+
+func (h *taskEventsHub) unsubscribe(ownerID uint, s *taskSubscriber) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if _, ok := h.subscribers[ownerID][s]; !ok {
+		return
+	}
+	delete(h.subscribers[ownerID], s)
+	close(s.send)
+	if len(h.subscribers[ownerID]) == 0 {
+		delete(h.subscribers, ownerID)
+	}
+}
+
+// send event to every session of list, slow session which cant keep up is dropped
+// and has to load the list again after reconnect
+func (h *taskEventsHub) publish(ownerID uint, event TaskEvent) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	for s := range h.subscribers[ownerID] {
+		select {
+		case s.send <- event:
+		default:
+			delete(h.subscribers[ownerID], s)
+			close(s.send)
+		}
+	}
+	if len(h.subscribers[ownerID]) == 0 {
+		delete(h.subscribers, ownerID)
+	}
+}
+
+// broadcast change made by request, must be called after transaction is committed
+func broadcastTaskEvent(c *gin.Context, ownerID uint, eventType string, tasks []models.TasksModel) {
+	if len(tasks) == 0 {
+		return
+	}
+	taskEvents.publish(ownerID, TaskEvent{
+		Type:   eventType,
+		Tasks:  tasks,
+		Origin: c.GetHeader(TaskClientIDHeader),
+	})
+}
+
+func broadcastTasksDeleted(c *gin.Context, ownerID uint, tasks []models.TasksModel) {
+	if len(tasks) == 0 {
+		return
+	}
+	localIDs := make([]uint, 0, len(tasks))
+	for _, task := range tasks {
+		localIDs = append(localIDs, task.LocalID)
+	}
+	taskEvents.publish(ownerID, TaskEvent{
+		Type:     TaskEventDeleted,
+		LocalIDs: localIDs,
+		Origin:   c.GetHeader(TaskClientIDHeader),
+	})
+}
+
+// tasks changed in different ways(undo, restore), trashed ones are sent as deleted.
+// task which is in list several times is sent once in its newest version
+func broadcastTaskChanges(c *gin.Context, ownerID uint, tasks []models.TasksModel) {
+	newest := make(map[uint]models.TasksModel)
+	var ids []uint
+	for _, task := range tasks {
+		current, ok := newest[task.ID]
+		if !ok {
+			ids = append(ids, task.ID)
+		}
+		if !ok || task.Version >= current.Version {
+			newest[task.ID] = task
+		}
+	}
+
+	var updated, deleted []models.TasksModel
+	for _, id := range ids {
+		task := newest[id]
+		if task.DeletedAt.Valid {
+			deleted = append(deleted, task)
+		} else {
+			updated = append(updated, task)
+		}
+	}
+	broadcastTaskEvent(c, ownerID, TaskEventUpdated, updated)
+	broadcastTasksDeleted(c, ownerID, deleted)
+}
+
+// websocket with changes of task list, own or shared one(?owner=<uniqueID>).
+// only server writes to it, messages of client are ignored
+func TaskEventsSocket(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+	}
+
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("Failed to upgrade task events connection: %v", err)
+		return
+	}
+
+	s := &taskSubscriber{
+		ws:   ws,
+		send: make(chan TaskEvent, taskEventsBufferSize),
+	}
+	taskEvents.subscribe(ownerID, s)
+
+	go s.writePump()
+	go s.readPump(ownerID)
+}
+
+// reads only to notice closed connection
+func (s *taskSubscriber) readPump(ownerID uint) {
+	defer func() {
+		taskEvents.unsubscribe(ownerID, s)
+		s.ws.Close()
+	}()
+
+	s.ws.SetReadLimit(512)
+	s.ws.SetReadDeadline(time.Now().Add(2 * taskEventsPingPeriod))
+	s.ws.SetPongHandler(func(string) error {
+		return s.ws.SetReadDeadline(time.Now().Add(2 * taskEventsPingPeriod))
+	})
+
+	for {
+		if _, _, err := s.ws.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *taskSubscriber) writePump() {
+	ticker := time.NewTicker(taskEventsPingPeriod)
+	defer func() {
+		ticker.Stop()
+		s.ws.Close()
+	}()
+
+	for {
+		select {
+		case event, ok := <-s.send:
+			s.ws.SetWriteDeadline(time.Now().Add(taskEventsWriteWait))
+			if !ok {
+				s.ws.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := s.ws.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ticker.C:
+			s.ws.SetWriteDeadline(time.Now().Add(taskEventsWriteWait))
+			if err := s.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// renumbered list is sent to open sessions, versions did not change so only order is new
+func publishRebalancedOrder(userID uint) {
+	var tasks []models.TasksModel
+	if err := initializers.DB.Where("user_id = ?", userID).Order("`order` asc, id asc").Find(&tasks).Error; err != nil {
+		log.Printf("Failed to load rebalanced tasks of user %d: %v", userID, err)
+		return
+	}
+	if len(tasks) > 0 {
+		taskEvents.publish(userID, TaskEvent{Type: TaskEventReordered, Tasks: tasks})
+	}
+}
+
+// tasks of list by primary keys, used to send current copies after bulk updates
+func taskIDs(tasks []models.TasksModel) []uint {
+	ids := make([]uint, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
+
+func tasksByIDs(ids []uint) []models.TasksModel {
+	if len(ids) == 0 {
+		return nil
+	}
+	var tasks []models.TasksModel
+	if err := initializers.DB.Where("id IN ?", ids).Order("`order` asc, id asc").Find(&tasks).Error; err != nil {
+		log.Printf("Failed to load changed tasks: %v", err)
+		return nil
+	}
+	return tasks
+}
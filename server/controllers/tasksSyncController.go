@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"time"
+)
+
+const (
+	TaskSyncMaxMutations = 200
+
+	//changes committed a bit before token was issued can still show up after it,
+	//so next sync starts this much earlier. repeated tasks are harmless, versions are the same
+	TaskSyncClockSkew = 5 * time.Second
+)
+
+// statuses of offline mutations
+const (
+	TaskMutationApplied  = "applied"
+	TaskMutationConflict = "conflict"
+	TaskMutationDeleted  = "deleted"
+	TaskMutationFailed   = "failed"
+)
+
+// position in change log, opaque for client
+type taskSyncToken struct {
+	Since time.Time `json:"since"`
+}
+
+// change made offline, ID is generated by client and makes retries safe.
+// task is referenced by localId or by clientId if it was created offline too
+type taskMutation struct {
+	ID string `json:"id" binding:"required,max=64"`
+	taskOperation
+}
+
+type taskMutationResult struct {
+	ID     string             `json:"id"`
+	Status string             `json:"status"`
+	Error  string             `json:"error,omitempty"`
+	Task   *models.TasksModel `json:"task,omitempty"`
+
+	//failed because of server error, such result is not remembered so retry runs again
+	retry bool
+	//move renumbered the whole list, open sessions get all new orders
+	renumbered bool
+}
+
+type taskTombstone struct {
+	LocalID   uint      `json:"localId"`
+	ClientID  *string   `json:"clientId,omitempty"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+func getTaskMutationKey(userID uint, mutationID string) string {
+	return fmt.Sprintf("tasks:%d:mutation:%s", userID, mutationID)
+}
+
+// token of sync request, empty or too old one means client needs full list
+func parseTaskSyncToken(token string) (*time.Time, error) {
+	if token == "" {
+		return nil, nil
+	}
+
+	var position taskSyncToken
+	if err := utils.DecodeCursor(token, &position); err != nil {
+		return nil, err
+	}
+
+	//tombstones of purged tasks are kept only for trash retention period
+	if position.Since.Before(time.Now().Add(-utils.TrashRetention())) {
+		return nil, nil
+	}
+	return &position.Since, nil
+}
+
+// apply one offline mutation in its own transaction, so conflict of one does not drop others.
+// conflicts are resolved the same way every time:
+//   - create is matched by clientId, sending it again returns the same task
+//   - update and move need version the client based change on, stale ones lose to server copy
+//   - complete and delete are applied over any version, the later one to reach server wins
+//   - change of a task which is in trash or purged loses to deletion
+func applyTaskMutation(ownerID uint, mutation taskMutation) taskMutationResult {
+	result := taskMutationResult{ID: mutation.ID}
+	op := mutation.taskOperation
+
+	switch op.Op {
+	case TaskOpUpdate, TaskOpMove:
+		if op.Version == nil {
+			result.Status = TaskMutationFailed
+			result.Error = "Version is required!"
+			return result
+		}
+	case TaskOpComplete, TaskOpDelete:
+		op.Version = nil
+		op.anyVersion = true
+	}
+
+	var task models.TasksModel
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var history []models.TaskHistoryModel
+		var err error
+		task, history, result.renumbered, err = applyTaskOperation(tx, ownerID, op)
+		if err != nil {
+			return err
+		}
+		return recordTaskHistory(tx, history...)
+	})
+
+	var opErr taskOperationError
+	switch {
+	case err == nil:
+		result.Status = TaskMutationApplied
+		result.Task = &task
+	case errors.Is(err, errBatchVersionConflict):
+		current, findErr := findSyncedTask(ownerID, op)
+		if findErr != nil {
+			result.Status = TaskMutationFailed
+			result.Error = "Cant load task!"
+			result.retry = true
+			break
+		}
+		result.Status = TaskMutationConflict
+		result.Error = err.Error()
+		result.Task = &current
+	case errors.Is(err, errBatchTaskNotFound):
+		//deleting what is already gone is not a conflict
+		if op.Op == TaskOpDelete {
+			result.Status = TaskMutationApplied
+			break
+		}
+		result.Status = TaskMutationDeleted
+		result.Error = err.Error()
+	case errors.As(err, &opErr):
+		result.Status = TaskMutationFailed
+		result.Error = opErr.Error()
+	default:
+		log.Printf("Failed to apply task mutation %s of user %d: %v", mutation.ID, ownerID, err)
+		result.Status = TaskMutationFailed
+		result.Error = "Cant apply change!"
+		result.retry = true
+	}
+
+	return result
+}
+
+// current copy of task mutation was about
+func findSyncedTask(ownerID uint, op taskOperation) (models.TasksModel, error) {
+	var task models.TasksModel
+	query := initializers.DB.Where("local_id = ? AND user_id = ?", op.LocalID, ownerID)
+	if op.LocalID == 0 && op.ClientID != "" {
+		query = initializers.DB.Where("client_id = ? AND user_id = ?", op.ClientID, ownerID)
+	}
+	err := query.First(&task).Error
+	return task, err
+}
+
+// result of mutation which was already applied, client retried after lost response
+func storedTaskMutationResult(ownerID uint, mutationID string) (taskMutationResult, bool) {
+	var result taskMutationResult
+	data, err := initializers.RedisClient.Get(initializers.Ctx, getTaskMutationKey(ownerID, mutationID)).Bytes()
+	if err != nil {
+		return result, false
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return result, false
+	}
+	return result, true
+}
+
+func storeTaskMutationResult(ownerID uint, result taskMutationResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+	initializers.RedisClient.Set(initializers.Ctx, getTaskMutationKey(ownerID, result.ID), data, utils.TrashRetention())
+}
+
+// respond with tasks changed after since and tombstones of deleted ones, nil since means full list
+func respondTaskChanges(c *gin.Context, ownerID uint, since *time.Time, results []taskMutationResult) {
+	//taken before queries, so nothing committed while they run is skipped next time
+	next := utils.EncodeCursor(taskSyncToken{Since: time.Now().Add(-TaskSyncClockSkew)})
+
+	changes := []models.TasksModel{}
+	query := initializers.DB.Where("user_id = ?", ownerID)
+	if since != nil {
+		query = query.Where("updated_at > ?", *since)
+	}
+	if err := query.Order("`order` asc, id asc").Find(&changes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task changes!"})
+		return
+	}
+
+	if err := attachCommentCounts(changes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant count task comments!"})
+		return
+	}
+
+	if err := attachTaskDependencies(changes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task dependencies!"})
+		return
+	}
+
+	tombstones := []taskTombstone{}
+	if since != nil {
+		var trashed []models.TasksModel
+		if err := initializers.DB.Unscoped().
+			Where("user_id = ? AND deleted_at > ?", ownerID, *since).
+			Find(&trashed).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task changes!"})
+			return
+		}
+		for _, task := range trashed {
+			tombstones = append(tombstones, taskTombstone{LocalID: task.LocalID, ClientID: task.ClientID, DeletedAt: task.DeletedAt.Time})
+		}
+
+		var purged []models.TaskTombstoneModel
+		if err := initializers.DB.Where("user_id = ? AND purged_at > ?", ownerID, *since).Find(&purged).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load task changes!"})
+			return
+		}
+		for _, tombstone := range purged {
+			tombstones = append(tombstones, taskTombstone{LocalID: tombstone.LocalID, ClientID: tombstone.ClientID, DeletedAt: tombstone.PurgedAt})
+		}
+	}
+
+	response := gin.H{
+		"token":      next,
+		"reset":      since == nil,
+		"changes":    changes,
+		"tombstones": tombstones,
+	}
+	if results != nil {
+		response["results"] = results
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// changes of task list after ?since=<token>, without token whole list is sent with reset flag
+func GetTaskChanges(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	since, err := parseTaskSyncToken(c.Query("since"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong sync token!"})
+		return
+	}
+
+	respondTaskChanges(c, ownerID, since, nil)
+}
+
+// apply mutations made offline in order they were made, then respond like GetTaskChanges
+func SyncTasks(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var input struct {
+		Since     string         `json:"since"`
+		Mutations []taskMutation `json:"mutations" binding:"dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(input.Mutations) > TaskSyncMaxMutations {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many changes, max is " + strconv.Itoa(TaskSyncMaxMutations) + "!"})
+		return
+	}
+
+	since, err := parseTaskSyncToken(input.Since)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong sync token!"})
+		return
+	}
+
+	results := make([]taskMutationResult, 0, len(input.Mutations))
+	var applied []taskOperationResult
+	renumbered := false
+	for i, mutation := range input.Mutations {
+		if stored, ok := storedTaskMutationResult(ownerID, mutation.ID); ok {
+			results = append(results, stored)
+			continue
+		}
+
+		result := applyTaskMutation(ownerID, mutation)
+		results = append(results, result)
+
+		if result.Status == TaskMutationApplied && result.Task != nil {
+			applied = append(applied, taskOperationResult{Index: i, Op: mutation.Op, Status: "ok", Task: result.Task})
+			renumbered = renumbered || result.renumbered
+		}
+		if !result.retry {
+			storeTaskMutationResult(ownerID, result)
+		}
+	}
+
+	if len(applied) > 0 {
+		invalidateUserTaskCaches(ownerID)
+		broadcastBatchResults(c, ownerID, applied)
+		if renumbered {
+			publishRebalancedOrder(ownerID)
+		}
+	}
+
+	respondTaskChanges(c, ownerID, since, results)
+}
@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"log"
+	"net/http"
+	"server/initializers"
+	"server/models"
+	"server/utils"
+	"strconv"
+	"time"
+)
+
+// list of tasks that are in trash(soft deleted)
+func GetTrashedTasks(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var tasks []models.TasksModel
+	if err := initializers.DB.Unscoped().
+		Where("user_id = ? AND deleted_at IS NOT NULL", ownerID).
+		Order("deleted_at desc").
+		Find(&tasks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant load trash!"})
+		return
+	}
+
+	retention := utils.TrashRetention()
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":          tasks,
+		"retentionDays": int(retention / (24 * time.Hour)),
+	})
+}
+
+func RestoreTask(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	localTaskIDStr := c.Param("id")
+	localTaskID, err := strconv.Atoi(localTaskIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong task id!"})
+		return
+	}
+
+	var task models.TasksModel
+
+	if err := initializers.DB.Unscoped().
+		Where("local_id = ? AND user_id = ? AND deleted_at IS NOT NULL", localTaskID, ownerID).
+		First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task in trash!"})
+		return
+	}
+
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		if err := restoreTasks(tx, []models.TasksModel{task}); err != nil {
+			return err
+		}
+		//restore bumped version, client needs the new one for its next change
+		return tx.First(&task, task.ID).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant restore task!"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+	broadcastTaskEvent(c, ownerID, TaskEventCreated, []models.TasksModel{task})
+	broadcastDependents(c, ownerID, task.ID)
+
+	c.Header("ETag", taskETag(task))
+	c.JSON(http.StatusOK, gin.H{"data": task})
+}
+
+// restore several tasks from trash, if no ids are sent whole trash is restored
+func RestoreTasks(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var input struct {
+		LocalIDs []uint `json:"localIds"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tasks []models.TasksModel
+	var count int
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", ownerID)
+		if len(input.LocalIDs) > 0 {
+			query = query.Where("local_id IN ?", input.LocalIDs)
+		}
+
+		if err := query.Find(&tasks).Error; err != nil {
+			return err
+		}
+		count = len(tasks)
+		return restoreTasks(tx, tasks)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant restore tasks!"})
+		return
+	}
+
+	if count == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "No tasks to restore"})
+		return
+	}
+
+	invalidateUserTaskCaches(ownerID)
+
+	//restored tasks got new version, send current copies
+	var ids []uint
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+	}
+	broadcastTaskEvent(c, ownerID, TaskEventCreated, tasksByIDs(ids))
+	broadcastDependents(c, ownerID, ids...)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tasks successfully restored!", "count": count})
+}
+
+// permanently delete one task from trash
+func PurgeTask(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	localTaskIDStr := c.Param("id")
+	localTaskID, err := strconv.Atoi(localTaskIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Wrong task id!"})
+		return
+	}
+
+	var task models.TasksModel
+
+	if err := initializers.DB.Unscoped().
+		Where("local_id = ? AND user_id = ? AND deleted_at IS NOT NULL", localTaskID, ownerID).
+		First(&task).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cant find a task in trash!"})
+		return
+	}
+
+	var attachments []models.TaskAttachmentModel
+	err = initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		attachments, err = purgeTasks(tx, []models.TasksModel{task})
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant delete task!"})
+		return
+	}
+
+	deleteAttachmentFiles(initializers.Storage, attachments)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Task permanently deleted!"})
+}
+
+// permanently delete all tasks from trash
+func EmptyTrash(c *gin.Context) {
+	ownerID := taskOwnerID(c)
+
+	var count int
+	var attachments []models.TaskAttachmentModel
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var tasks []models.TasksModel
+		if err := tx.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", ownerID).Find(&tasks).Error; err != nil {
+			return err
+		}
+		count = len(tasks)
+
+		var err error
+		attachments, err = purgeTasks(tx, tasks)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cant empty trash!"})
+		return
+	}
+
+	deleteAttachmentFiles(initializers.Storage, attachments)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Trash successfully emptied!", "count": count})
+}
+
+// take tasks out of trash and record it as one history group
+func restoreTasks(tx *gorm.DB, tasks []models.TasksModel) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(tasks))
+	history := make([]models.TaskHistoryModel, 0, len(tasks))
+	for _, task := range tasks {
+		ids = append(ids, task.ID)
+		history = append(history, newTaskHistory(task, models.TaskActionRestored, "", ""))
+	}
+
+	if err := tx.Unscoped().Model(&models.TasksModel{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"deleted_at": nil,
+		"version":    gorm.Expr("version + 1"),
+	}).Error; err != nil {
+		return err
+	}
+	if err := touchDependents(tx, ids...); err != nil {
+		return err
+	}
+
+	return recordTaskHistory(tx, history...)
+}
+
+// permanently delete tasks together with their history, comments and attachments.
+// removed attachments are returned, their files are deleted after commit
+func purgeTasks(tx *gorm.DB, tasks []models.TasksModel) ([]models.TaskAttachmentModel, error) {
+	var removed []models.TaskAttachmentModel
+	for _, task := range tasks {
+		if err := tx.Unscoped().Where("task_id = ?", task.ID).Delete(&models.TaskCommentModel{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Where("task_id = ? OR blocked_by_id = ?", task.ID, task.ID).Delete(&models.TaskDependencyModel{}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Unscoped().
+			Where("user_id = ? AND task_local_id = ?", task.UserID, task.LocalID).
+			Delete(&models.TaskHistoryModel{}).Error; err != nil {
+			return nil, err
+		}
+
+		var attachments []models.TaskAttachmentModel
+		if err := tx.Where("task_id = ?", task.ID).Find(&attachments).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Unscoped().Where("task_id = ?", task.ID).Delete(&models.TaskAttachmentModel{}).Error; err != nil {
+			return nil, err
+		}
+		removed = append(removed, attachments...)
+
+		if err := tx.Unscoped().Delete(&task).Error; err != nil {
+			return nil, err
+		}
+
+		//offline clients learn about purge from sync
+		if err := tx.Create(&models.TaskTombstoneModel{
+			UserID:   task.UserID,
+			LocalID:  task.LocalID,
+			ClientID: task.ClientID,
+			PurgedAt: time.Now(),
+		}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return removed, nil
+}
+
+// permanently delete tasks which stayed in trash longer than retention period,
+// same way as purge from trash does, so offline clients get tombstones of them too
+func PurgeExpiredTrash() (int, error) {
+	cutoff := time.Now().Add(-utils.TrashRetention())
+
+	var tasks []models.TasksModel
+	if err := initializers.DB.Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+
+	var attachments []models.TaskAttachmentModel
+	err := initializers.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		attachments, err = purgeTasks(tx, tasks)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	deleteAttachmentFiles(initializers.Storage, attachments)
+
+	//sync tokens older than retention get full list, so their tombstones are not needed
+	if err := initializers.DB.Where("purged_at < ?", cutoff).Delete(&models.TaskTombstoneModel{}).Error; err != nil {
+		return len(tasks), err
+	}
+
+	return len(tasks), nil
+}
+
+func StartTrashPurger() {
+	go func() {
+		ticker := time.NewTicker(utils.TrashPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			count, err := PurgeExpiredTrash()
+			if err != nil {
+				log.Printf("Failed to purge trash: %v", err)
+			} else if count > 0 {
+				log.Printf("Purged %d expired tasks from trash", count)
+			}
+			<-ticker.C
+		}
+	}()
+}
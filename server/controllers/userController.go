@@ -16,6 +16,7 @@ import (
 	"server/initializers"
 	"server/models"
 	"server/utils"
+	"strconv"
 	"time"
 )
 
@@ -568,6 +569,9 @@ func Validate(c *gin.Context) {
 		"email":    userModel.Email,
 		"username": userModel.Username,
 		"uniqueID": userModel.UniqueID,
+		"timeZone": userModel.Location().String(),
+
+		"archiveAfterDays": userModel.ArchiveAfterDays,
 	})
 }
 
@@ -610,6 +614,28 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	//comments of user and comments on his tasks delete
+	if err := tx.Unscoped().
+		Where("author_id = ? OR task_id IN (?)", userID, tx.Unscoped().Model(&models.TasksModel{}).Select("id").Where("user_id = ?", userID)).
+		Delete(&models.TaskCommentModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's task comments"})
+		return
+	}
+
+	//attachments of user tasks delete, files are removed after commit
+	var attachments []models.TaskAttachmentModel
+	if err := tx.Where("user_id = ?", userID).Find(&attachments).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's task attachments"})
+		return
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.TaskAttachmentModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's task attachments"})
+		return
+	}
+
 	//tasks delete
 	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.TasksModel{}).Error; err != nil {
 		tx.Rollback()
@@ -617,6 +643,72 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	//tasks history delete
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.TaskHistoryModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's tasks history"})
+		return
+	}
+
+	//board columns delete
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.TaskColumnModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's board columns"})
+		return
+	}
+
+	//task dependencies delete
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TaskDependencyModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's task dependencies"})
+		return
+	}
+
+	//tombstones of purged tasks delete
+	if err := tx.Where("user_id = ?", userID).Delete(&models.TaskTombstoneModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's task tombstones"})
+		return
+	}
+
+	//task templates delete
+	if err := tx.Unscoped().Where("template_id IN (?)", tx.Model(&models.TaskTemplateModel{}).Unscoped().Select("id").Where("user_id = ?", userID)).Delete(&models.TaskTemplateItemModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's task templates"})
+		return
+	}
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.TaskTemplateModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's task templates"})
+		return
+	}
+
+	//smart lists delete
+	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.TaskSmartListModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's smart lists"})
+		return
+	}
+
+	//task list shares delete
+	if err := tx.Unscoped().Where("owner_id = ? OR member_id = ?", userID, userID).Delete(&models.TaskShareModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's task shares"})
+		return
+	}
+
+	//chat messages delete, conversation with deleted user cant be opened anymore
+	if err := tx.Where("sender_id = ? OR receiver_id = ?", currentUser.UniqueID, currentUser.UniqueID).Delete(&models.ChatMessageModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's chat messages"})
+		return
+	}
+	if err := tx.Where("user_id = ? OR room_id LIKE ? OR room_id LIKE ?", currentUser.UniqueID, currentUser.UniqueID+":%", "%:"+currentUser.UniqueID).Delete(&models.ChatReadModel{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user's chat messages"})
+		return
+	}
+
 	//stats delete
 	if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.StatsModel{}).Error; err != nil {
 		tx.Rollback()
@@ -638,6 +730,8 @@ func DeleteUser(c *gin.Context) {
 		return
 	}
 
+	deleteAttachmentFiles(initializers.Storage, attachments)
+
 	c.SetCookie("token", "", -1, "/", "", false, true)
 	c.SetCookie("refresh_token", "", -1, "/", "", false, true)
 
@@ -699,3 +793,85 @@ func ChangeUsername(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"success": "Username updated successfully!"})
 }
+
+// time zone is used for everything counted in days: streaks, today filter
+func ChangeTimeZone(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	currentUser, ok := user.(models.User)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	var body struct {
+		TimeZone string `json:"timeZone"`
+	}
+
+	if c.Bind(&body) != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+		return
+	}
+
+	if !utils.IsValidTimeZone(body.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone, use IANA name like Europe/Riga"})
+		return
+	}
+
+	invalidateUserCache(currentUser)
+
+	currentUser.TimeZone = body.TimeZone
+	if err := initializers.DB.Model(&currentUser).Update("time_zone", currentUser.TimeZone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update time zone"})
+		return
+	}
+
+	cacheUser(currentUser)
+
+	c.JSON(http.StatusOK, gin.H{"success": "Time zone updated successfully!", "timeZone": currentUser.TimeZone})
+}
+
+// completed tasks of user are archived after given number of days, 0 turns archiving off
+func ChangeArchivePolicy(c *gin.Context) {
+	user, exists := c.Get("user")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	currentUser, ok := user.(models.User)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user"})
+		return
+	}
+
+	var body struct {
+		ArchiveAfterDays *uint `json:"archiveAfterDays" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read body"})
+		return
+	}
+
+	if *body.ArchiveAfterDays > TaskArchiveMaxDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Archive period must be between 0 and " + strconv.Itoa(TaskArchiveMaxDays) + " days"})
+		return
+	}
+
+	invalidateUserCache(currentUser)
+
+	currentUser.ArchiveAfterDays = *body.ArchiveAfterDays
+	if err := initializers.DB.Model(&currentUser).Update("archive_after_days", currentUser.ArchiveAfterDays).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update archive policy"})
+		return
+	}
+
+	cacheUser(currentUser)
+
+	c.JSON(http.StatusOK, gin.H{"success": "Archive policy updated successfully!", "archiveAfterDays": currentUser.ArchiveAfterDays})
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"server/initializers"
 	"server/models"
+	"server/utils"
 	"time"
 )
 
@@ -104,12 +105,12 @@ func UpdateDailyStreak(c *gin.Context) {
 		return
 	}
 
-	//get today date and last visit date
-	today := time.Now().Truncate(24 * time.Hour)
-	lastVisit := stats.LastVisitDate.Truncate(24 * time.Hour)
+	//days are counted in users time zone, not in server or UTC one
+	now := time.Now()
+	dayDiff := utils.DaysBetween(stats.LastVisitDate, now, currentUser.Location())
 
 	//if last visit date is today date, nothing change
-	if today.Equal(lastVisit) {
+	if dayDiff <= 0 {
 		c.JSON(http.StatusOK, gin.H{
 			"currentStreak": stats.CurrentStreak,
 			"highestStreak": stats.HighestStreak,
@@ -118,9 +119,6 @@ func UpdateDailyStreak(c *gin.Context) {
 		return
 	}
 
-	//calculate day diff
-	dayDiff := int(today.Sub(lastVisit).Hours() / 24)
-
 	//refresh streak value based on order of visit
 	if dayDiff == 1 {
 		//if visit is on day after, increment streak
@@ -136,7 +134,7 @@ func UpdateDailyStreak(c *gin.Context) {
 	}
 
 	//refresh last visit date and total visit number
-	stats.LastVisitDate = time.Now()
+	stats.LastVisitDate = now
 	stats.TotalVisitDays++
 
 	//save changes to db
@@ -0,0 +1,40 @@
+package initializers
+
+import (
+	"log"
+	"os"
+	"server/storage"
+)
+
+var Storage storage.Storage
+
+// storage of task attachments, STORAGE_DRIVER is "local"(default) or "s3"
+func ConnectToStorage() {
+	switch os.Getenv("STORAGE_DRIVER") {
+	case "s3":
+		s3, err := storage.NewS3Storage(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+		)
+		if err != nil {
+			log.Fatalf("Cant configure s3 storage: %v", err)
+		}
+		if err := s3.EnsureBucket(Ctx); err != nil {
+			log.Fatalf("Cant connect to s3 storage: %v", err)
+		}
+		Storage = s3
+	default:
+		dir := os.Getenv("ATTACHMENTS_DIR")
+		if dir == "" {
+			dir = "uploads/attachments"
+		}
+		local, err := storage.NewLocalStorage(dir)
+		if err != nil {
+			log.Fatalf("Cant create attachments directory: %v", err)
+		}
+		Storage = local
+	}
+}
@@ -6,7 +6,7 @@ import (
 )
 
 func SyncDatabase() {
-	err := DB.AutoMigrate(&models.User{}, &models.PomodoroModel{}, &models.TasksModel{}, &models.StatsModel{})
+	err := DB.AutoMigrate(&models.User{}, &models.PomodoroModel{}, &models.TasksModel{}, &models.StatsModel{}, &models.TaskHistoryModel{}, &models.TaskShareModel{}, &models.TaskCommentModel{}, &models.TaskAttachmentModel{}, &models.TaskColumnModel{}, &models.TaskTemplateModel{}, &models.TaskTemplateItemModel{}, &models.TaskTombstoneModel{}, &models.TaskDependencyModel{}, &models.TaskSmartListModel{}, &models.ChatMessageModel{}, &models.ChatReadModel{})
 
 	if err != nil {
 		log.Fatalf("Could not migrate database: %v", err)
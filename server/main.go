@@ -4,6 +4,7 @@ import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"log"
+	"server/controllers"
 	"server/initializers"
 	"server/routes"
 	"time"
@@ -14,6 +15,7 @@ func init() {
 	initializers.ConnectToDb()
 	initializers.SyncDatabase()
 	initializers.ConnectToRedis()
+	initializers.ConnectToStorage()
 	initializers.InitOAuthConfigs()
 }
 
@@ -30,7 +32,7 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:8000", "http://localhost:3000", "http://83.99.161.62:3000"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", controllers.TaskClientIDHeader},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           24 * time.Hour,
@@ -44,6 +46,13 @@ func main() {
 	routes.OAuthRoutes(r)
 	routes.ChatRoutes(r)
 
+	//background jobs
+	controllers.StartTrashPurger()
+	controllers.StartTaskOrderRebalancer()
+	controllers.StartDeferredTasksWatcher()
+	controllers.StartTaskArchiver()
+	controllers.StartChatBackplane()
+
 	log.Fatal(r.Run())
 
 }
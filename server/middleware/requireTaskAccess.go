@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"server/initializers"
+	"server/models"
+)
+
+// key of task list owner id in gin context
+const TaskOwnerKey = "taskOwnerID"
+
+// resolve whose task list is used and check current user access to it.
+// own list is used by default, shared list is selected with ?owner=<uniqueID>
+func RequireTaskAccess(required models.TaskRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, exists := c.Get("user")
+		if !exists {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		currentUser := user.(models.User)
+
+		ownerUniqueID := c.Query("owner")
+		if ownerUniqueID == "" || ownerUniqueID == currentUser.UniqueID {
+			c.Set(TaskOwnerKey, currentUser.ID)
+			c.Next()
+			return
+		}
+
+		var owner models.User
+		if err := initializers.DB.Where("unique_id = ?", ownerUniqueID).First(&owner).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Task list not found!"})
+			return
+		}
+
+		var share models.TaskShareModel
+		if err := initializers.DB.
+			Where("owner_id = ? AND member_id = ? AND status = ?", owner.ID, currentUser.ID, models.ShareStatusAccepted).
+			First(&share).Error; err != nil {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Task list not found!"})
+			return
+		}
+
+		if !share.Role.Allows(required) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "You dont have permission to do this!"})
+			return
+		}
+
+		c.Set(TaskOwnerKey, owner.ID)
+		c.Next()
+	}
+}
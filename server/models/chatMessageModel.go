@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// message of conversation between two users, RoomID is built from their uniqueIDs
+type ChatMessageModel struct {
+	ID         uint   `gorm:"primarykey;index:idx_chat_room_id,priority:2"`
+	RoomID     string `gorm:"size:32;index:idx_chat_room_id,priority:1"`
+	SenderID   string `gorm:"size:12;index"`
+	ReceiverID string `gorm:"size:12;index"`
+	Body       string `gorm:"size:512"`
+	CreatedAt  time.Time
+
+	//nil until receiver got message over socket, undelivered ones are sent when he connects
+	DeliveredAt *time.Time
+}
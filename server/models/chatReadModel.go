@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// last message of conversation user has read, later messages to him are unread
+type ChatReadModel struct {
+	ID         uint   `gorm:"primarykey"`
+	RoomID     string `gorm:"size:32;uniqueIndex:idx_chat_read_pair"`
+	UserID     string `gorm:"size:12;uniqueIndex:idx_chat_read_pair;index"` //uniqueID like in messages
+	LastReadID uint
+	UpdatedAt  time.Time
+}
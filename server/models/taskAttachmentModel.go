@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+// file attached to a task, content lives in storage under StorageKey.
+// UserID is owner of task list, uploads count against owners quota
+type TaskAttachmentModel struct {
+	gorm.Model
+	TaskID      uint   `gorm:"index"`
+	UserID      uint   `gorm:"index"`
+	UploaderID  uint   `gorm:"index"`
+	FileName    string `gorm:"size:255"`
+	ContentType string `gorm:"size:127"`
+	Size        int64
+	StorageKey  string `gorm:"size:255;uniqueIndex"`
+}
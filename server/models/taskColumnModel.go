@@ -0,0 +1,12 @@
+package models
+
+import "gorm.io/gorm"
+
+// workflow column of a task list board, tasks in IsDone column are completed
+type TaskColumnModel struct {
+	gorm.Model
+	UserID uint    `gorm:"index"`
+	Name   string  `gorm:"size:50"`
+	Order  float64 `gorm:"default:0"`
+	IsDone bool    `gorm:"default:false"`
+}
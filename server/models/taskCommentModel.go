@@ -0,0 +1,16 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// comment of a task, replies point to parent comment
+type TaskCommentModel struct {
+	gorm.Model
+	TaskID   uint   `gorm:"index"`
+	AuthorID uint   `gorm:"index"`
+	ParentID *uint  `gorm:"index"`
+	Body     string `gorm:"type:text"`
+	EditedAt *time.Time
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// task TaskID can be done only after task BlockedByID, both are in list of UserID
+type TaskDependencyModel struct {
+	ID          uint `gorm:"primaryKey"`
+	UserID      uint `gorm:"index"`
+	TaskID      uint `gorm:"uniqueIndex:idx_task_dependency,priority:1"`
+	BlockedByID uint `gorm:"uniqueIndex:idx_task_dependency,priority:2;index"`
+	CreatedAt   time.Time
+}
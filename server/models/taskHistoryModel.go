@@ -0,0 +1,31 @@
+package models
+
+import "gorm.io/gorm"
+
+type TaskAction string
+
+const (
+	TaskActionCreated            TaskAction = "created"
+	TaskActionTitleChanged       TaskAction = "title_changed"
+	TaskActionDescriptionChanged TaskAction = "description_changed"
+	TaskActionCompleted          TaskAction = "completed"
+	TaskActionUncompleted        TaskAction = "uncompleted"
+	TaskActionReordered          TaskAction = "reordered"
+	TaskActionDeleted            TaskAction = "deleted"
+	TaskActionRestored           TaskAction = "restored"
+	TaskActionStatusChanged      TaskAction = "status_changed"
+	TaskActionDeferred           TaskAction = "deferred"
+	TaskActionTriaged            TaskAction = "triaged"
+)
+
+// one change of a task, entries written by the same request share GroupID
+type TaskHistoryModel struct {
+	gorm.Model
+	UserID      uint       `gorm:"index:idx_task_history_task"`
+	TaskLocalID uint       `gorm:"index:idx_task_history_task"`
+	GroupID     string     `gorm:"index;size:32"`
+	Action      TaskAction `gorm:"size:32"`
+	OldValue    string     `gorm:"type:text"`
+	NewValue    string     `gorm:"type:text"`
+	Undone      bool       `gorm:"default:false"`
+}
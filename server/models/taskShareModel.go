@@ -0,0 +1,34 @@
+package models
+
+import "gorm.io/gorm"
+
+type TaskRole string
+
+const (
+	TaskRoleViewer TaskRole = "viewer"
+	TaskRoleEditor TaskRole = "editor"
+	TaskRoleOwner  TaskRole = "owner"
+)
+
+type ShareStatus string
+
+const (
+	ShareStatusPending  ShareStatus = "pending"
+	ShareStatusAccepted ShareStatus = "accepted"
+	ShareStatusDeclined ShareStatus = "declined"
+)
+
+// access of member to owners task list
+type TaskShareModel struct {
+	gorm.Model
+	OwnerID  uint        `gorm:"uniqueIndex:idx_task_share_pair"`
+	MemberID uint        `gorm:"uniqueIndex:idx_task_share_pair;index"`
+	Role     TaskRole    `gorm:"size:16;default:'viewer'"`
+	Status   ShareStatus `gorm:"size:16;default:'pending'"`
+}
+
+// check if role gives at least required access
+func (r TaskRole) Allows(required TaskRole) bool {
+	rank := map[TaskRole]int{TaskRoleViewer: 1, TaskRoleEditor: 2, TaskRoleOwner: 3}
+	return rank[r] >= rank[required]
+}
@@ -0,0 +1,11 @@
+package models
+
+import "gorm.io/gorm"
+
+// named task query of a list, shown next to normal lists
+type TaskSmartListModel struct {
+	gorm.Model
+	UserID uint   `gorm:"index"`
+	Name   string `gorm:"size:50"`
+	Query  string `gorm:"size:255"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "gorm.io/gorm"
+
+// reusable checklist of a task list, every item becomes a task when template is used
+type TaskTemplateModel struct {
+	gorm.Model
+	UserID uint                    `gorm:"index"`
+	Name   string                  `gorm:"size:50"`
+	Items  []TaskTemplateItemModel `gorm:"foreignKey:TemplateID"`
+}
+
+// title and description may contain variables like {{date}}, they are filled in on use
+type TaskTemplateItemModel struct {
+	gorm.Model
+	TemplateID  uint `gorm:"index"`
+	Position    int
+	Title       string
+	Description string
+	Tags        TagList `gorm:"size:512"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// task which was permanently deleted, kept so offline clients learn about it on sync.
+// tasks in trash need no tombstone, their DeletedAt is used
+type TaskTombstoneModel struct {
+	ID       uint `gorm:"primaryKey"`
+	UserID   uint `gorm:"index"`
+	LocalID  uint
+	ClientID *string   `gorm:"size:64"`
+	PurgedAt time.Time `gorm:"index"`
+}
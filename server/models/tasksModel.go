@@ -1,13 +1,131 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
 
 type TasksModel struct {
 	gorm.Model
-	UserID      uint
+	UserID      uint `gorm:"index:idx_tasks_user_order,priority:1;uniqueIndex:idx_tasks_user_client,priority:1"`
 	LocalID     uint
 	Title       string
 	Description string
-	Completed   bool `gorm:"default:false"`
-	Order       int  `gorm:"default:0"`
+	Completed   bool       `gorm:"default:false"`
+	DueDate     *time.Time `gorm:"index"`
+	Tags        TagList    `gorm:"size:512"`
+
+	//task is hidden from list until this moment(start date or snooze)
+	DeferUntil *time.Time `gorm:"index"`
+	//newly captured task which was not triaged yet
+	Inbox bool `gorm:"default:false"`
+
+	//when task was completed, old completed tasks are moved to archive(ArchivedAt) by users policy
+	CompletedAt *time.Time `gorm:"index"`
+	ArchivedAt  *time.Time `gorm:"index"`
+
+	//one of TaskPriority values and planned number of pomodoros, 0 means not set
+	Priority         uint8 `gorm:"default:0"`
+	PomodoroEstimate uint  `gorm:"default:0"`
+
+	//board column(status) of task, nil means default column for Completed value.
+	//Completed is kept in sync with IsDone of the column
+	ColumnID *uint `gorm:"index"`
+
+	//id generated by client which created task offline, retried create finds the same task
+	ClientID *string `gorm:"size:64;uniqueIndex:idx_tasks_user_client,priority:2"`
+
+	//fractional key, moved task gets order between its neighbours so only one row changes.
+	//list is renumbered when gaps get too small
+	Order float64 `gorm:"default:0;index:idx_tasks_user_order,priority:2"`
+
+	//bumped on every change, clients send it back as If-Match
+	Version uint `gorm:"not null;default:1"`
+
+	//not stored, counted from comments table when list is loaded
+	CommentCount int64 `gorm:"-"`
+
+	//not stored, local ids of tasks this one waits for and if any of them is still open
+	BlockedBy []uint `gorm:"-"`
+	Blocked   bool   `gorm:"-"`
+}
+
+const (
+	TaskPriorityNone uint8 = iota
+	TaskPriorityLow
+	TaskPriorityMedium
+	TaskPriorityHigh
+)
+
+// tags stored in one column as ",work,home," so single tag can be matched with LIKE
+type TagList []string
+
+// lowercase, no spaces and no duplicates
+func NormalizeTags(tags []string) TagList {
+	seen := make(map[string]bool)
+	result := TagList{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+		tag = strings.Trim(strings.ReplaceAll(tag, ",", "-"), "#")
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// condition value to find tasks with tag, use with "tags LIKE ?"
+func TagPattern(tag string) string {
+	normalized := NormalizeTags([]string{tag})
+	if len(normalized) == 0 {
+		return ""
+	}
+	return "%," + normalized[0] + ",%"
+}
+
+func (TagList) GormDataType() string {
+	return "string"
+}
+
+// always an array in json, even for task without tags
+func (t TagList) MarshalJSON() ([]byte, error) {
+	if t == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t TagList) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return "", nil
+	}
+	return "," + strings.Join(t, ",") + ",", nil
+}
+
+func (t *TagList) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case nil:
+		raw = ""
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into TagList", value)
+	}
+
+	*t = TagList{}
+	for _, tag := range strings.Split(raw, ",") {
+		if tag != "" {
+			*t = append(*t, tag)
+		}
+	}
+	return nil
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"fmt"
 	"gorm.io/gorm"
+	"time"
 )
 
 type AuthProvider string
@@ -30,10 +31,25 @@ type User struct {
 	EmailConfirmationCode string
 	OAuthProvider         AuthProvider  `gorm:"default:'local'"`
 	OAuthProviderID       string        `gorm:"index"`
+	TimeZone              string        `gorm:"size:64;default:'UTC'"` //IANA name, days of streaks and today filter are counted in it
+	ArchiveAfterDays      uint          `gorm:"default:0"`             //completed tasks are archived after this many days, 0 turns it off
+	LastTaskLocalID       uint          `gorm:"default:0"`             //last localID given to a task, only grows so purged ids are never reused
 	Tasks                 []TasksModel  //one-to-many
 	Pomodoro              PomodoroModel //one-to-one #mb need to rework to one-to-many
 }
 
+// location of users time zone, UTC if it is empty or unknown
+func (u User) Location() *time.Location {
+	if u.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
 func (u *User) BeforeCreate(tx *gorm.DB) (err error) {
 	for i := 0; i < maxIDAttempts; i++ {
 		id := generateRandomID()
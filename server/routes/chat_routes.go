@@ -8,4 +8,7 @@ import (
 
 func ChatRoutes(router *gin.Engine) {
 	router.GET("/chat", middleware.RequireAuth, controllers.ChatSocket)
+	router.GET("/chat/history", middleware.RequireAuth, controllers.GetChatHistory)
+	router.GET("/chat/unread", middleware.RequireAuth, controllers.GetChatUnread)
+	router.PUT("/chat/read", middleware.RequireAuth, controllers.MarkChatRead)
 }
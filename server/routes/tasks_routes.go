@@ -4,16 +4,95 @@ import (
 	"github.com/gin-gonic/gin"
 	"server/controllers"
 	"server/middleware"
+	"server/models"
 )
 
 func TasksRoutes(router *gin.Engine) {
-	router.GET("/tasks", middleware.RequireAuth, controllers.GetAllTasks)
-	router.POST("/tasks-create", middleware.RequireAuth, controllers.CreateTask)
-	router.PUT("/task/update-description/:id", middleware.RequireAuth, controllers.UpdateTaskDescription)
-	router.PUT("/task/update-title/:id", middleware.RequireAuth, controllers.UpdateTaskTitle)
-	router.PUT("/task/complete/:id", middleware.RequireAuth, controllers.CompleteTask)
-	router.PUT("/tasks/order", middleware.RequireAuth, controllers.UpdateTasksOrder)
-	router.DELETE("/task/delete/:id", middleware.RequireAuth, controllers.DeleteTask)
-	router.DELETE("/task/delete-all", middleware.RequireAuth, controllers.DeleteAllTasks)
-	router.DELETE("/task/delete-completed", middleware.RequireAuth, controllers.DeleteAllCompletedTasks)
+	//access to own or shared task list(?owner=<uniqueID>)
+	canView := middleware.RequireTaskAccess(models.TaskRoleViewer)
+	canEdit := middleware.RequireTaskAccess(models.TaskRoleEditor)
+	isOwner := middleware.RequireTaskAccess(models.TaskRoleOwner)
+
+	router.GET("/tasks", middleware.RequireAuth, canView, controllers.GetAllTasks)
+	router.GET("/tasks/live", middleware.RequireAuth, canView, controllers.TaskEventsSocket)
+	router.GET("/tasks/sync", middleware.RequireAuth, canView, controllers.GetTaskChanges)
+	router.POST("/tasks/sync", middleware.RequireAuth, canEdit, controllers.SyncTasks)
+	router.POST("/tasks-create", middleware.RequireAuth, canEdit, controllers.CreateTask)
+	router.POST("/tasks/quick-add", middleware.RequireAuth, canEdit, controllers.QuickAddTask)
+	router.PUT("/task/update-description/:id", middleware.RequireAuth, canEdit, controllers.UpdateTaskDescription)
+	router.PUT("/task/update-title/:id", middleware.RequireAuth, canEdit, controllers.UpdateTaskTitle)
+	router.PUT("/task/complete/:id", middleware.RequireAuth, canEdit, controllers.CompleteTask)
+	router.PUT("/tasks/order", middleware.RequireAuth, canEdit, controllers.UpdateTasksOrder)
+	router.PUT("/task/move/:id", middleware.RequireAuth, canEdit, controllers.MoveTask)
+	router.POST("/tasks/batch", middleware.RequireAuth, canEdit, controllers.BatchTasks)
+	router.GET("/tasks/export/:format", middleware.RequireAuth, canView, controllers.ExportTasks)
+	router.POST("/tasks/import/:format", middleware.RequireAuth, canEdit, controllers.ImportTasks)
+	router.POST("/tasks/import-from/:source", middleware.RequireAuth, canEdit, controllers.ImportExternalTasks)
+	router.DELETE("/task/delete/:id", middleware.RequireAuth, canEdit, controllers.DeleteTask)
+	router.DELETE("/task/delete-all", middleware.RequireAuth, canEdit, controllers.DeleteAllTasks)
+	router.DELETE("/task/delete-completed", middleware.RequireAuth, canEdit, controllers.DeleteAllCompletedTasks)
+
+	//trash
+	router.GET("/tasks/trash", middleware.RequireAuth, canView, controllers.GetTrashedTasks)
+	router.PUT("/task/restore/:id", middleware.RequireAuth, canEdit, controllers.RestoreTask)
+	router.PUT("/tasks/trash/restore", middleware.RequireAuth, canEdit, controllers.RestoreTasks)
+	router.DELETE("/task/purge/:id", middleware.RequireAuth, isOwner, controllers.PurgeTask)
+	router.DELETE("/tasks/trash/empty", middleware.RequireAuth, isOwner, controllers.EmptyTrash)
+
+	//history
+	router.GET("/task/history/:id", middleware.RequireAuth, canView, controllers.GetTaskHistory)
+	router.POST("/task/undo/:id", middleware.RequireAuth, canEdit, controllers.UndoTaskChange)
+	router.POST("/tasks/undo", middleware.RequireAuth, canEdit, controllers.UndoLastTaskChange)
+
+	//comments
+	router.GET("/task/comments/:id", middleware.RequireAuth, canView, controllers.GetTaskComments)
+	router.POST("/task/comments/:id", middleware.RequireAuth, canView, controllers.CreateTaskComment)
+	router.PUT("/task/comment/:commentId", middleware.RequireAuth, canView, controllers.UpdateTaskComment)
+	router.DELETE("/task/comment/:commentId", middleware.RequireAuth, canView, controllers.DeleteTaskComment)
+
+	//dependencies
+	router.GET("/task/dependencies/:id", middleware.RequireAuth, canView, controllers.GetTaskDependencies)
+	router.POST("/task/dependencies/:id", middleware.RequireAuth, canEdit, controllers.AddTaskDependency)
+	router.DELETE("/task/dependencies/:id/:blockerId", middleware.RequireAuth, canEdit, controllers.DeleteTaskDependency)
+
+	//board
+	router.GET("/tasks/board", middleware.RequireAuth, canView, controllers.GetTasksBoard)
+	router.POST("/tasks/columns", middleware.RequireAuth, canEdit, controllers.CreateTaskColumn)
+	router.PUT("/tasks/columns/:columnId", middleware.RequireAuth, canEdit, controllers.UpdateTaskColumn)
+	router.DELETE("/tasks/columns/:columnId", middleware.RequireAuth, canEdit, controllers.DeleteTaskColumn)
+	router.PUT("/task/status/:id", middleware.RequireAuth, canEdit, controllers.MoveTaskToColumn)
+
+	//start dates, snooze and inbox
+	router.PUT("/task/defer/:id", middleware.RequireAuth, canEdit, controllers.DeferTask)
+	router.PUT("/task/snooze/:id", middleware.RequireAuth, canEdit, controllers.SnoozeTask)
+	router.PUT("/task/triage/:id", middleware.RequireAuth, canEdit, controllers.TriageTask)
+
+	//smart lists
+	router.GET("/tasks/smart-lists", middleware.RequireAuth, canView, controllers.GetTaskSmartLists)
+	router.POST("/tasks/smart-lists", middleware.RequireAuth, canEdit, controllers.CreateTaskSmartList)
+	router.PUT("/tasks/smart-lists/:listId", middleware.RequireAuth, canEdit, controllers.UpdateTaskSmartList)
+	router.DELETE("/tasks/smart-lists/:listId", middleware.RequireAuth, canEdit, controllers.DeleteTaskSmartList)
+
+	//templates
+	router.GET("/tasks/templates", middleware.RequireAuth, canView, controllers.GetTaskTemplates)
+	router.POST("/tasks/templates", middleware.RequireAuth, canEdit, controllers.CreateTaskTemplate)
+	router.POST("/task/template/:id", middleware.RequireAuth, canEdit, controllers.SaveTaskAsTemplate)
+	router.PUT("/tasks/templates/:templateId", middleware.RequireAuth, canEdit, controllers.UpdateTaskTemplate)
+	router.DELETE("/tasks/templates/:templateId", middleware.RequireAuth, canEdit, controllers.DeleteTaskTemplate)
+	router.POST("/tasks/templates/:templateId/use", middleware.RequireAuth, canEdit, controllers.UseTaskTemplate)
+
+	//attachments
+	router.GET("/task/attachments/:id", middleware.RequireAuth, canView, controllers.GetTaskAttachments)
+	router.POST("/task/attachments/:id", middleware.RequireAuth, canEdit, controllers.UploadTaskAttachment)
+	router.GET("/task/attachment/:attachmentId", middleware.RequireAuth, canView, controllers.DownloadTaskAttachment)
+	router.DELETE("/task/attachment/:attachmentId", middleware.RequireAuth, canEdit, controllers.DeleteTaskAttachment)
+	router.GET("/attachments/:attachmentId", controllers.DownloadSignedAttachment)
+
+	//sharing
+	router.GET("/tasks/shares", middleware.RequireAuth, controllers.GetTaskShares)
+	router.POST("/tasks/shares", middleware.RequireAuth, controllers.ShareTaskList)
+	router.PUT("/tasks/shares/:id/role", middleware.RequireAuth, controllers.UpdateTaskShareRole)
+	router.DELETE("/tasks/shares/:id", middleware.RequireAuth, controllers.DeleteTaskShare)
+	router.POST("/tasks/invitations/:id/accept", middleware.RequireAuth, controllers.AcceptTaskInvitation)
+	router.POST("/tasks/invitations/:id/decline", middleware.RequireAuth, controllers.DeclineTaskInvitation)
 }
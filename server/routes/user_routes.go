@@ -19,6 +19,8 @@ func UserRoutes(router *gin.Engine) {
 		userGroup.POST("refresh-token", controllers.RefreshToken)
 
 		userGroup.PUT("update-username", middleware.RequireAuth, controllers.ChangeUsername)
+		userGroup.PUT("update-timezone", middleware.RequireAuth, controllers.ChangeTimeZone)
+		userGroup.PUT("update-archive-policy", middleware.RequireAuth, controllers.ChangeArchivePolicy)
 
 		userGroup.DELETE("delete-user", middleware.RequireAuth, controllers.DeleteUser)
 	}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultAttachmentMaxSizeMB = 10
+	DefaultAttachmentsQuotaMB  = 100
+	AttachmentURLTTL           = 15 * time.Minute
+)
+
+// types detected by sniffing content, what client says is ignored
+var allowedAttachmentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+	"text/plain":      true,
+	"application/zip": true,
+}
+
+func envMegabytes(name string, fallback int) int64 {
+	mb, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || mb < 1 {
+		mb = fallback
+	}
+	return int64(mb) << 20
+}
+
+// max size of one file, configurable with ATTACHMENT_MAX_SIZE_MB
+func AttachmentMaxSize() int64 {
+	return envMegabytes("ATTACHMENT_MAX_SIZE_MB", DefaultAttachmentMaxSizeMB)
+}
+
+// total size of files in one task list, configurable with ATTACHMENTS_QUOTA_MB
+func AttachmentsQuota() int64 {
+	return envMegabytes("ATTACHMENTS_QUOTA_MB", DefaultAttachmentsQuotaMB)
+}
+
+// sniffed type without parameters if it can be attached, "" otherwise
+func AttachmentContentType(sniffed string) string {
+	contentType := strings.TrimSpace(strings.Split(sniffed, ";")[0])
+	if !allowedAttachmentTypes[contentType] {
+		return ""
+	}
+	return contentType
+}
+
+func attachmentSignature(attachmentID uint, expires int64) string {
+	h := hmac.New(sha256.New, []byte(os.Getenv("SECRET")))
+	fmt.Fprintf(h, "attachment:%d:%d", attachmentID, expires)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// download path which works without auth header until it expires,
+// so it can be used in <img> or opened in new tab
+func SignAttachmentURL(attachmentID uint) (string, time.Time) {
+	expiresAt := time.Now().Add(AttachmentURLTTL)
+	expires := expiresAt.Unix()
+	return fmt.Sprintf("/attachments/%d?expires=%d&signature=%s", attachmentID, expires, attachmentSignature(attachmentID, expires)), expiresAt
+}
+
+func IsValidAttachmentSignature(attachmentID uint, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(attachmentSignature(attachmentID, expires)))
+}
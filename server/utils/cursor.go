@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// encode pagination position as opaque string, client sends it back unchanged
+func EncodeCursor(position interface{}) string {
+	data, err := json.Marshal(position)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decode cursor created by EncodeCursor into position
+func DecodeCursor(cursor string, position interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, position)
+}
@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"regexp"
+	"server/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const QuickAddMaxEstimate = 99
+
+// task fields parsed from one quick-add line
+type QuickAddResult struct {
+	Title            string     `json:"title"`
+	DueDate          *time.Time `json:"dueDate"`
+	Tags             []string   `json:"tags"`
+	Priority         uint8      `json:"priority"`
+	PomodoroEstimate uint       `json:"pomodoroEstimate"`
+}
+
+// lone "!" is left in title, it is too common at end of sentence to mean low priority
+var quickAddPriorities = map[string]uint8{
+	"!!":      models.TaskPriorityMedium,
+	"!!!":     models.TaskPriorityHigh,
+	"!1":      models.TaskPriorityLow,
+	"!2":      models.TaskPriorityMedium,
+	"!3":      models.TaskPriorityHigh,
+	"!low":    models.TaskPriorityLow,
+	"!medium": models.TaskPriorityMedium,
+	"!med":    models.TaskPriorityMedium,
+	"!high":   models.TaskPriorityHigh,
+}
+
+var quickAddWeekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+var (
+	quickAddEstimateRegex = regexp.MustCompile(`^~(\d{1,2})$`)
+	quickAddClockRegex    = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+	quickAdd24hRegex      = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+	quickAddInRegex       = regexp.MustCompile(`^(day|days|week|weeks)$`)
+)
+
+// date phrase starting at tokens[i], returns day in loc and number of tokens used
+func parseQuickAddDate(tokens []string, i int, today time.Time) (time.Time, int, bool) {
+	word := strings.ToLower(tokens[i])
+	next := ""
+	if i+1 < len(tokens) {
+		next = strings.ToLower(tokens[i+1])
+	}
+
+	switch word {
+	case "today":
+		return today, 1, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), 1, true
+	case "next":
+		if next == "week" {
+			return nextWeekday(today, time.Monday), 2, true
+		}
+		if weekday, ok := quickAddWeekdays[next]; ok {
+			return nextWeekday(today, weekday), 2, true
+		}
+	case "in":
+		//"in 3 days", "in 2 weeks"
+		if i+2 < len(tokens) && quickAddInRegex.MatchString(strings.ToLower(tokens[i+2])) {
+			n, err := strconv.Atoi(next)
+			if err != nil || n < 1 || n > 365 {
+				return time.Time{}, 0, false
+			}
+			if strings.HasPrefix(strings.ToLower(tokens[i+2]), "week") {
+				n *= 7
+			}
+			return today.AddDate(0, 0, n), 3, true
+		}
+	}
+
+	if weekday, ok := quickAddWeekdays[word]; ok {
+		return nextWeekday(today, weekday), 1, true
+	}
+
+	if day, err := time.ParseInLocation("2006-01-02", word, today.Location()); err == nil {
+		return day, 1, true
+	}
+
+	return time.Time{}, 0, false
+}
+
+// first day after today which falls on weekday
+func nextWeekday(today time.Time, weekday time.Weekday) time.Time {
+	days := (int(weekday) - int(today.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	return today.AddDate(0, 0, days)
+}
+
+// time of day like "5pm", "5:30pm" or "17:00" starting at tokens[i]
+func parseQuickAddTime(tokens []string, i int) (hour int, minute int, used int, ok bool) {
+	word := strings.ToLower(tokens[i])
+
+	//"5 pm" is written in two tokens
+	if i+1 < len(tokens) {
+		next := strings.ToLower(tokens[i+1])
+		if next == "am" || next == "pm" {
+			if h, m, _, ok := parseQuickAddTime([]string{word + next}, 0); ok {
+				return h, m, 2, true
+			}
+		}
+	}
+
+	if match := quickAddClockRegex.FindStringSubmatch(word); match != nil {
+		hour, _ = strconv.Atoi(match[1])
+		if match[2] != "" {
+			minute, _ = strconv.Atoi(match[2])
+		}
+		if hour < 1 || hour > 12 || minute > 59 {
+			return 0, 0, 0, false
+		}
+		hour %= 12
+		if match[3] == "pm" {
+			hour += 12
+		}
+		return hour, minute, 1, true
+	}
+
+	if match := quickAdd24hRegex.FindStringSubmatch(word); match != nil {
+		hour, _ = strconv.Atoi(match[1])
+		minute, _ = strconv.Atoi(match[2])
+		if hour > 23 || minute > 59 {
+			return 0, 0, 0, false
+		}
+		return hour, minute, 1, true
+	}
+
+	return 0, 0, 0, false
+}
+
+// parse line like "Review PR tomorrow 5pm #work !high ~2".
+// #tag adds tag, !low/!medium/!high(or !1-!3, !! for medium and !!! for high) sets priority, ~N sets pomodoro estimate.
+// first date and first time set due date in loc, date without time means end of that day
+// and time without date means its next occurrence. everything else stays in title
+func ParseQuickAdd(line string, now time.Time, loc *time.Location) QuickAddResult {
+	result := QuickAddResult{Tags: []string{}}
+	today := StartOfDay(now, loc)
+
+	var day *time.Time
+	hour, minute := -1, -1
+
+	tokens := strings.Fields(line)
+	var title []string
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		lower := strings.ToLower(token)
+
+		if strings.HasPrefix(token, "#") && len(token) > 1 {
+			result.Tags = append(result.Tags, token[1:])
+			continue
+		}
+
+		if priority, ok := quickAddPriorities[lower]; ok && result.Priority == models.TaskPriorityNone {
+			result.Priority = priority
+			continue
+		}
+
+		if match := quickAddEstimateRegex.FindStringSubmatch(token); match != nil && result.PomodoroEstimate == 0 {
+			estimate, _ := strconv.Atoi(match[1])
+			if estimate >= 1 && estimate <= QuickAddMaxEstimate {
+				result.PomodoroEstimate = uint(estimate)
+				continue
+			}
+		}
+
+		if day == nil {
+			if parsed, used, ok := parseQuickAddDate(tokens, i, today); ok {
+				day = &parsed
+				i += used - 1
+				title = dropQuickAddPreposition(title, "on", "by", "due")
+				continue
+			}
+		}
+
+		if hour < 0 {
+			if h, m, used, ok := parseQuickAddTime(tokens, i); ok {
+				hour, minute = h, m
+				i += used - 1
+				title = dropQuickAddPreposition(title, "at")
+				continue
+			}
+		}
+
+		title = append(title, token)
+	}
+
+	result.Title = strings.Join(title, " ")
+	result.Tags = models.NormalizeTags(result.Tags)
+
+	switch {
+	case day != nil && hour >= 0:
+		due := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, loc)
+		result.DueDate = &due
+	case day != nil:
+		due := time.Date(day.Year(), day.Month(), day.Day(), 23, 59, 0, 0, loc)
+		result.DueDate = &due
+	case hour >= 0:
+		due := time.Date(today.Year(), today.Month(), today.Day(), hour, minute, 0, 0, loc)
+		if !due.After(now) {
+			due = due.AddDate(0, 0, 1)
+		}
+		result.DueDate = &due
+	}
+
+	return result
+}
+
+// "at 5pm" or "due tomorrow" should not leave the preposition in title
+func dropQuickAddPreposition(title []string, words ...string) []string {
+	if len(title) == 0 {
+		return title
+	}
+	last := strings.ToLower(title[len(title)-1])
+	for _, word := range words {
+		if last == word {
+			return title[:len(title)-1]
+		}
+	}
+	return title
+}
@@ -0,0 +1,97 @@
+package utils
+
+import (
+	"server/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+// friday evening in time zone of user
+var quickAddLoc = time.FixedZone("UTC+3", 3*60*60)
+var quickAddNow = time.Date(2024, 5, 10, 22, 30, 0, 0, quickAddLoc)
+
+func TestParseQuickAddDueDate(t *testing.T) {
+	at := func(month time.Month, day int, hour int, minute int) *time.Time {
+		v := time.Date(2024, month, day, hour, minute, 0, 0, quickAddLoc)
+		return &v
+	}
+
+	tests := []struct {
+		line  string
+		title string
+		due   *time.Time
+	}{
+		{"Review PR tomorrow 5pm", "Review PR", at(5, 11, 17, 0)},
+		{"Pay rent on friday", "Pay rent", at(5, 17, 23, 59)},
+		{"Sync next monday 5 pm", "Sync", at(5, 13, 17, 0)},
+		{"Plan next week", "Plan", at(5, 13, 23, 59)},
+		{"Trip in 2 weeks", "Trip", at(5, 24, 23, 59)},
+		{"Ship due 2024-06-01 at 9:30am", "Ship", at(6, 1, 9, 30)},
+		{"Call at 23:00", "Call", at(5, 10, 23, 0)},
+		{"Call at 9am", "Call", at(5, 11, 9, 0)},
+		{"Report today", "Report", at(5, 10, 23, 59)},
+		{"Done yesterday", "Done yesterday", nil},
+		{"Meet at 25:00", "Meet at 25:00", nil},
+		{"Rest in 0 days", "Rest in 0 days", nil},
+	}
+
+	for _, tt := range tests {
+		result := ParseQuickAdd(tt.line, quickAddNow, quickAddLoc)
+		if result.Title != tt.title {
+			t.Errorf("%q: title = %q, want %q", tt.line, result.Title, tt.title)
+		}
+		if (result.DueDate == nil) != (tt.due == nil) || (tt.due != nil && !result.DueDate.Equal(*tt.due)) {
+			t.Errorf("%q: due = %v, want %v", tt.line, result.DueDate, tt.due)
+		}
+	}
+}
+
+func TestParseQuickAddPriority(t *testing.T) {
+	tests := []struct {
+		line     string
+		title    string
+		priority uint8
+	}{
+		{"Fix bug !high", "Fix bug", models.TaskPriorityHigh},
+		{"Fix bug !med", "Fix bug", models.TaskPriorityMedium},
+		{"Fix bug !1", "Fix bug", models.TaskPriorityLow},
+		{"Fix bug !!", "Fix bug", models.TaskPriorityMedium},
+		{"Fix bug !!!", "Fix bug", models.TaskPriorityHigh},
+		{"!low first wins !high", "first wins !high", models.TaskPriorityLow},
+		{"Wow it works !", "Wow it works !", models.TaskPriorityNone},
+		{"Say hi!", "Say hi!", models.TaskPriorityNone},
+	}
+
+	for _, tt := range tests {
+		result := ParseQuickAdd(tt.line, quickAddNow, quickAddLoc)
+		if result.Title != tt.title || result.Priority != tt.priority {
+			t.Errorf("%q: title = %q priority = %d, want %q %d", tt.line, result.Title, result.Priority, tt.title, tt.priority)
+		}
+	}
+}
+
+func TestParseQuickAddEstimateAndTags(t *testing.T) {
+	tests := []struct {
+		line     string
+		title    string
+		estimate uint
+		tags     string
+	}{
+		{"Write docs ~3 #Work #work #docs", "Write docs", 3, "work,docs"},
+		{"Write docs ~0", "Write docs ~0", 0, ""},
+		{"Write docs ~100", "Write docs ~100", 0, ""},
+		{"Write docs ~2 ~4", "Write docs ~4", 2, ""},
+		{"Price # is 5", "Price # is 5", 0, ""},
+	}
+
+	for _, tt := range tests {
+		result := ParseQuickAdd(tt.line, quickAddNow, quickAddLoc)
+		if result.Title != tt.title || result.PomodoroEstimate != tt.estimate {
+			t.Errorf("%q: title = %q estimate = %d, want %q %d", tt.line, result.Title, result.PomodoroEstimate, tt.title, tt.estimate)
+		}
+		if got := strings.Join(result.Tags, ","); got != tt.tags {
+			t.Errorf("%q: tags = %s, want %s", tt.line, got, tt.tags)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package utils
+
+import "time"
+
+// snooze presets, resolved in time zone of user who snoozes
+const (
+	SnoozeLaterToday = "later_today"
+	SnoozeTomorrow   = "tomorrow"
+	SnoozeNextWeek   = "next_week"
+)
+
+const (
+	//snoozed tasks come back at start of work day
+	SnoozeMorningHour = 9
+	SnoozeLaterHours  = 3
+)
+
+// moment preset points to, false for unknown preset
+func SnoozeUntil(preset string, now time.Time, loc *time.Location) (time.Time, bool) {
+	today := StartOfDay(now, loc)
+	morning := func(day time.Time) time.Time {
+		return time.Date(day.Year(), day.Month(), day.Day(), SnoozeMorningHour, 0, 0, 0, loc)
+	}
+
+	switch preset {
+	case SnoozeLaterToday:
+		//full hour a few hours later, may fall on next day late in the evening
+		later := now.In(loc).Add(SnoozeLaterHours * time.Hour)
+		return time.Date(later.Year(), later.Month(), later.Day(), later.Hour(), 0, 0, 0, loc), true
+	case SnoozeTomorrow:
+		return morning(today.AddDate(0, 0, 1)), true
+	case SnoozeNextWeek:
+		days := (int(time.Monday) - int(today.Weekday()) + 7) % 7
+		if days == 0 {
+			days = 7
+		}
+		return morning(today.AddDate(0, 0, days)), true
+	}
+	return time.Time{}, false
+}
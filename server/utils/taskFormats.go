@@ -0,0 +1,416 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"server/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TaskFormatJSON     = "json"
+	TaskFormatCSV      = "csv"
+	TaskFormatMarkdown = "markdown"
+	TaskFormatTodoTxt  = "todotxt"
+)
+
+var ErrUnknownTaskFormat = errors.New("unknown task format")
+
+var csvHeader = []string{"title", "description", "completed", "created_at"}
+
+// task parsed from imported file, Row is line or item number in that file
+type ImportedTask struct {
+	Row         int        `json:"row"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	DueDate     *time.Time `json:"dueDate,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+
+	//only JSON export has these, other formats leave them empty. todoist import sets Order
+	Priority    uint8      `json:"priority,omitempty"`
+	Estimate    uint       `json:"pomodoroEstimate,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	Order       float64    `json:"order,omitempty"`
+}
+
+type ImportRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// content type and file extension of export format
+func TaskFormatFile(format string) (contentType string, extension string, err error) {
+	switch format {
+	case TaskFormatJSON:
+		return "application/json", "json", nil
+	case TaskFormatCSV:
+		return "text/csv", "csv", nil
+	case TaskFormatMarkdown:
+		return "text/markdown", "md", nil
+	case TaskFormatTodoTxt:
+		return "text/plain", "txt", nil
+	}
+	return "", "", ErrUnknownTaskFormat
+}
+
+// writes tasks one by one, so export can be streamed
+type TaskWriter interface {
+	WriteTask(task models.TasksModel) error
+	Close() error
+}
+
+func NewTaskWriter(format string, w io.Writer) (TaskWriter, error) {
+	switch format {
+	case TaskFormatJSON:
+		return &jsonTaskWriter{w: w}, nil
+	case TaskFormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &csvTaskWriter{w: cw}, nil
+	case TaskFormatMarkdown:
+		return &markdownTaskWriter{w: w}, nil
+	case TaskFormatTodoTxt:
+		return &todoTxtTaskWriter{w: w}, nil
+	}
+	return nil, ErrUnknownTaskFormat
+}
+
+type exportedTask struct {
+	LocalID     uint       `json:"localId"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Completed   bool       `json:"completed"`
+	Order       float64    `json:"order"`
+	DueDate     *time.Time `json:"dueDate,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Priority    uint8      `json:"priority,omitempty"`
+	Estimate    uint       `json:"pomodoroEstimate,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+}
+
+type jsonTaskWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (j *jsonTaskWriter) WriteTask(task models.TasksModel) error {
+	prefix := ",\n"
+	if !j.written {
+		prefix = "[\n"
+		j.written = true
+	}
+
+	data, err := json.Marshal(exportedTask{
+		LocalID:     task.LocalID,
+		Title:       task.Title,
+		Description: task.Description,
+		Completed:   task.Completed,
+		Order:       task.Order,
+		DueDate:     task.DueDate,
+		Tags:        task.Tags,
+		Priority:    task.Priority,
+		Estimate:    task.PomodoroEstimate,
+		CompletedAt: task.CompletedAt,
+		ArchivedAt:  task.ArchivedAt,
+		CreatedAt:   task.CreatedAt,
+		UpdatedAt:   task.UpdatedAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(j.w, prefix+string(data))
+	return err
+}
+
+func (j *jsonTaskWriter) Close() error {
+	if !j.written {
+		_, err := io.WriteString(j.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(j.w, "\n]\n")
+	return err
+}
+
+type csvTaskWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvTaskWriter) WriteTask(task models.TasksModel) error {
+	return c.w.Write([]string{
+		csvSafe(task.Title),
+		csvSafe(task.Description),
+		strconv.FormatBool(task.Completed),
+		task.CreatedAt.Format(time.RFC3339),
+	})
+}
+
+// spreadsheets run cells starting with these as formulas
+const csvFormulaChars = "=+-@\t\r"
+
+// quote value which spreadsheet would take as formula, import removes the quote again
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune(csvFormulaChars, rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func csvUnsafe(value string) string {
+	if len(value) > 1 && value[0] == '\'' && strings.ContainsRune(csvFormulaChars, rune(value[1])) {
+		return value[1:]
+	}
+	return value
+}
+
+func (c *csvTaskWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type markdownTaskWriter struct {
+	w io.Writer
+}
+
+func (m *markdownTaskWriter) WriteTask(task models.TasksModel) error {
+	mark := " "
+	if task.Completed {
+		mark = "x"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "- [%s] %s\n", mark, singleLine(task.Title))
+	//description goes under the item, indented so it stays part of it
+	if task.Description != "" {
+		for _, line := range strings.Split(task.Description, "\n") {
+			b.WriteString("  " + strings.TrimRight(line, "\r") + "\n")
+		}
+	}
+
+	_, err := io.WriteString(m.w, b.String())
+	return err
+}
+
+func (m *markdownTaskWriter) Close() error { return nil }
+
+// todo.txt is one line per task, so description is not exported
+type todoTxtTaskWriter struct {
+	w io.Writer
+}
+
+func (t *todoTxtTaskWriter) WriteTask(task models.TasksModel) error {
+	line := task.CreatedAt.Format("2006-01-02") + " " + singleLine(task.Title)
+	if task.Completed {
+		//tasks completed before completion moment was recorded use time of their last change
+		completedAt := task.UpdatedAt
+		if task.CompletedAt != nil {
+			completedAt = *task.CompletedAt
+		}
+		line = "x " + completedAt.Format("2006-01-02") + " " + line
+	}
+
+	_, err := io.WriteString(t.w, line+"\n")
+	return err
+}
+
+func (t *todoTxtTaskWriter) Close() error { return nil }
+
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// parse imported file, returned error means whole file is unreadable
+func ParseTasks(format string, r io.Reader) ([]ImportedTask, []ImportRowError, error) {
+	switch format {
+	case TaskFormatJSON:
+		return parseTasksJSON(r)
+	case TaskFormatCSV:
+		return parseTasksCSV(r)
+	case TaskFormatMarkdown:
+		return parseTasksMarkdown(r)
+	case TaskFormatTodoTxt:
+		return parseTasksTodoTxt(r)
+	}
+	return nil, nil, ErrUnknownTaskFormat
+}
+
+func parseTasksJSON(r io.Reader) ([]ImportedTask, []ImportRowError, error) {
+	var raw []json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, nil, err
+	}
+
+	var tasks []ImportedTask
+	var rowErrors []ImportRowError
+	for i, item := range raw {
+		var t ImportedTask
+		if err := json.Unmarshal(item, &t); err != nil {
+			rowErrors = append(rowErrors, ImportRowError{Row: i + 1, Error: "Invalid task object"})
+			continue
+		}
+		t.Row = i + 1
+		tasks = append(tasks, t)
+	}
+
+	return tasks, rowErrors, nil
+}
+
+func parseTasksCSV(r io.Reader) ([]ImportedTask, []ImportRowError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	titleCol, ok := columns["title"]
+	if !ok {
+		return nil, nil, errors.New("csv header must contain title column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	var tasks []ImportedTask
+	var rowErrors []ImportRowError
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rowErrors = append(rowErrors, ImportRowError{Row: row, Error: "Malformed csv row"})
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if titleCol >= len(record) {
+			rowErrors = append(rowErrors, ImportRowError{Row: row, Error: "Missing title"})
+			continue
+		}
+
+		tasks = append(tasks, ImportedTask{
+			Row:         row,
+			Title:       strings.TrimSpace(csvUnsafe(record[titleCol])),
+			Description: csvUnsafe(field(record, "description")),
+			Completed:   parseBoolLoose(field(record, "completed")),
+		})
+	}
+
+	return tasks, rowErrors, nil
+}
+
+func parseBoolLoose(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1", "yes", "y", "x", "done":
+		return true
+	}
+	return false
+}
+
+var markdownItem = regexp.MustCompile(`^(\s*)[-*+]\s+\[([ xX])\]\s+(.*)$`)
+
+func parseTasksMarkdown(r io.Reader) ([]ImportedTask, []ImportRowError, error) {
+	scanner := bufio.NewScanner(r)
+
+	var tasks []ImportedTask
+	var current *ImportedTask
+	var description []string
+
+	flush := func() {
+		if current != nil {
+			current.Description = strings.TrimSpace(strings.Join(description, "\n"))
+			tasks = append(tasks, *current)
+		}
+		current = nil
+		description = nil
+	}
+
+	for row := 1; scanner.Scan(); row++ {
+		line := scanner.Text()
+
+		//indented item under open one is a line of its description, exporter writes descriptions so
+		if m := markdownItem.FindStringSubmatch(line); m != nil && (current == nil || m[1] == "") {
+			flush()
+			current = &ImportedTask{
+				Row:       row,
+				Title:     strings.TrimSpace(m[3]),
+				Completed: m[2] != " ",
+			}
+			continue
+		}
+
+		//indented lines under checklist item are its description
+		if current != nil && (strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t") || strings.TrimSpace(line) == "") {
+			line = strings.TrimPrefix(line, "\t")
+			line = strings.TrimPrefix(line, "  ")
+			description = append(description, strings.TrimRight(line, " \r"))
+			continue
+		}
+
+		//any other text ends current item
+		flush()
+	}
+	flush()
+
+	return tasks, nil, scanner.Err()
+}
+
+var (
+	todoTxtDate     = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}\s+`)
+	todoTxtPriority = regexp.MustCompile(`^\([A-Z]\)\s+`)
+)
+
+func parseTasksTodoTxt(r io.Reader) ([]ImportedTask, []ImportRowError, error) {
+	scanner := bufio.NewScanner(r)
+
+	var tasks []ImportedTask
+	for row := 1; scanner.Scan(); row++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		task := ImportedTask{Row: row}
+		if strings.HasPrefix(line, "x ") {
+			task.Completed = true
+			line = strings.TrimSpace(line[2:])
+		}
+
+		line = todoTxtPriority.ReplaceAllString(line, "")
+		//completion and creation dates
+		for i := 0; i < 2 && todoTxtDate.MatchString(line); i++ {
+			line = todoTxtDate.ReplaceAllString(line, "")
+		}
+
+		task.Title = line
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil, scanner.Err()
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"server/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportTestTasks(t *testing.T, format string, tasks ...models.TasksModel) string {
+	t.Helper()
+	var b strings.Builder
+	w, err := NewTaskWriter(format, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, task := range tasks {
+		if err := w.WriteTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// checklist in description must come back as description, not as separate tasks
+func TestMarkdownRoundTrip(t *testing.T) {
+	exported := exportTestTasks(t, TaskFormatMarkdown,
+		models.TasksModel{Title: "Trip", Description: "pack:\n- [ ] tent\n- [x] map"},
+		models.TasksModel{Title: "Call mom", Completed: true},
+	)
+
+	tasks, _, err := ParseTasks(TaskFormatMarkdown, strings.NewReader(exported))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2: %+v", len(tasks), tasks)
+	}
+	if tasks[0].Title != "Trip" || tasks[0].Description != "pack:\n- [ ] tent\n- [x] map" {
+		t.Errorf("first task = %+v", tasks[0])
+	}
+	if tasks[1].Title != "Call mom" || !tasks[1].Completed {
+		t.Errorf("second task = %+v", tasks[1])
+	}
+}
+
+func TestCSVFormulaValuesAreQuoted(t *testing.T) {
+	exported := exportTestTasks(t, TaskFormatCSV,
+		models.TasksModel{Title: "=HYPERLINK(\"http://x\")", Description: "-1 day"},
+		models.TasksModel{Title: "plain", Description: "'quoted"},
+	)
+
+	for _, line := range strings.Split(exported, "\n")[1:] {
+		if strings.HasPrefix(line, "=") || strings.HasPrefix(line, "\"=") {
+			t.Errorf("formula is not quoted: %s", line)
+		}
+	}
+
+	tasks, _, err := ParseTasks(TaskFormatCSV, strings.NewReader(exported))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][2]string{{"=HYPERLINK(\"http://x\")", "-1 day"}, {"plain", "'quoted"}}
+	for i, task := range tasks {
+		if task.Title != want[i][0] || task.Description != want[i][1] {
+			t.Errorf("task %d = %q %q, want %q %q", i, task.Title, task.Description, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestTodoTxtUsesCompletionDate(t *testing.T) {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	completed := time.Date(2024, 5, 3, 10, 0, 0, 0, time.UTC)
+	updated := time.Date(2024, 5, 9, 10, 0, 0, 0, time.UTC)
+
+	task := models.TasksModel{Title: "Done", Completed: true, CompletedAt: &completed}
+	task.CreatedAt = created
+	task.UpdatedAt = updated
+
+	if got := exportTestTasks(t, TaskFormatTodoTxt, task); got != "x 2024-05-03 2024-05-01 Done\n" {
+		t.Errorf("todo.txt line = %q", got)
+	}
+}
@@ -0,0 +1,346 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	TaskSourceTodoist = "todoist"
+	TaskSourceTrello  = "trello"
+)
+
+var ErrUnknownTaskSource = errors.New("unknown task source")
+
+// parse export file of other todo app into tasks
+func ParseExternalTasks(source string, r io.Reader) ([]ImportedTask, []ImportRowError, error) {
+	switch source {
+	case TaskSourceTodoist:
+		return parseTodoistExport(r)
+	case TaskSourceTrello:
+		return parseTrelloExport(r)
+	}
+	return nil, nil, ErrUnknownTaskSource
+}
+
+// ids are strings in new exports and numbers in old ones
+type externalID string
+
+func (id *externalID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*id = ""
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*id = externalID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*id = externalID(n.String())
+	return nil
+}
+
+type checklistItem struct {
+	Name    string
+	Checked bool
+}
+
+// checklists have no own place in task model, they are kept as markdown under description
+func appendChecklist(description string, name string, items []checklistItem) string {
+	if len(items) == 0 {
+		return description
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(description))
+	if b.Len() > 0 {
+		b.WriteString("\n\n")
+	}
+	if name != "" {
+		b.WriteString(name + ":\n")
+	}
+	for _, item := range items {
+		mark := " "
+		if item.Checked {
+			mark = "x"
+		}
+		b.WriteString("- [" + mark + "] " + singleLine(item.Name) + "\n")
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+var externalDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05.000Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+func parseExternalDate(value string) *time.Time {
+	if value == "" {
+		return nil
+	}
+	for _, layout := range externalDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+type todoistExport struct {
+	Projects []struct {
+		ID   externalID `json:"id"`
+		Name string     `json:"name"`
+	} `json:"projects"`
+	Labels []struct {
+		ID   externalID `json:"id"`
+		Name string     `json:"name"`
+	} `json:"labels"`
+	Items []struct {
+		ID          externalID   `json:"id"`
+		Content     string       `json:"content"`
+		Description string       `json:"description"`
+		ProjectID   externalID   `json:"project_id"`
+		ParentID    externalID   `json:"parent_id"`
+		Labels      []externalID `json:"labels"`
+		Checked     interface{}  `json:"checked"`
+		ChildOrder  int          `json:"child_order"`
+		Due         *struct {
+			Date     string `json:"date"`
+			Datetime string `json:"datetime"`
+		} `json:"due"`
+	} `json:"items"`
+}
+
+func parseTodoistExport(r io.Reader) ([]ImportedTask, []ImportRowError, error) {
+	var export todoistExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, nil, err
+	}
+
+	projects := make(map[externalID]string)
+	for _, p := range export.Projects {
+		projects[p.ID] = p.Name
+	}
+	//old exports reference labels by id, new ones by name
+	labels := make(map[externalID]string)
+	for _, l := range export.Labels {
+		labels[l.ID] = l.Name
+	}
+
+	//subtasks of any depth become checklist of their top-level task, in todoist order
+	children := make(map[externalID][]int)
+	var roots []int
+	for i, item := range export.Items {
+		if item.ParentID != "" {
+			children[item.ParentID] = append(children[item.ParentID], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+	byChildOrder := func(indexes []int) func(a, b int) bool {
+		return func(a, b int) bool { return export.Items[indexes[a]].ChildOrder < export.Items[indexes[b]].ChildOrder }
+	}
+	for _, indexes := range children {
+		sort.SliceStable(indexes, byChildOrder(indexes))
+	}
+
+	used := make(map[int]bool)
+	var collectSubtasks func(id externalID) []checklistItem
+	collectSubtasks = func(id externalID) []checklistItem {
+		var items []checklistItem
+		for _, i := range children[id] {
+			if used[i] {
+				continue
+			}
+			used[i] = true
+			item := export.Items[i]
+			items = append(items, checklistItem{Name: item.Content, Checked: isChecked(item.Checked)})
+			items = append(items, collectSubtasks(item.ID)...)
+		}
+		return items
+	}
+
+	//child_order counts inside a project, so projects keep their order in file and do not interleave
+	projectIndex := make(map[externalID]int)
+	for i, p := range export.Projects {
+		projectIndex[p.ID] = i
+	}
+	projectOf := func(i int) int {
+		if index, ok := projectIndex[export.Items[i].ProjectID]; ok {
+			return index
+		}
+		return len(export.Projects)
+	}
+	sort.SliceStable(roots, func(a, b int) bool {
+		if projectOf(roots[a]) != projectOf(roots[b]) {
+			return projectOf(roots[a]) < projectOf(roots[b])
+		}
+		return export.Items[roots[a]].ChildOrder < export.Items[roots[b]].ChildOrder
+	})
+
+	var tasks []ImportedTask
+	for position, i := range roots {
+		item := export.Items[i]
+
+		var tags []string
+		if project, ok := projects[item.ProjectID]; ok && project != "" {
+			tags = append(tags, project)
+		}
+		for _, label := range item.Labels {
+			if name, ok := labels[label]; ok {
+				tags = append(tags, name)
+			} else {
+				tags = append(tags, string(label))
+			}
+		}
+
+		var due *time.Time
+		if item.Due != nil {
+			due = parseExternalDate(item.Due.Datetime)
+			if due == nil {
+				due = parseExternalDate(item.Due.Date)
+			}
+		}
+
+		tasks = append(tasks, ImportedTask{
+			Row:         i + 1,
+			Title:       strings.TrimSpace(item.Content),
+			Description: appendChecklist(item.Description, "", collectSubtasks(item.ID)),
+			Completed:   isChecked(item.Checked),
+			DueDate:     due,
+			Tags:        tags,
+			Order:       float64(position + 1),
+		})
+	}
+
+	//subtask whose parent is not in the file cant be placed anywhere
+	var rowErrors []ImportRowError
+	for i, item := range export.Items {
+		if item.ParentID != "" && !used[i] {
+			rowErrors = append(rowErrors, ImportRowError{Row: i + 1, Error: "Parent task not found"})
+		}
+	}
+
+	return tasks, rowErrors, nil
+}
+
+// todoist uses both 0/1 and true/false for checked
+func isChecked(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	}
+	return false
+}
+
+type trelloExport struct {
+	Name  string `json:"name"`
+	Lists []struct {
+		ID     string `json:"id"`
+		Name   string `json:"name"`
+		Closed bool   `json:"closed"`
+	} `json:"lists"`
+	Cards []struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		Desc        string `json:"desc"`
+		IDList      string `json:"idList"`
+		Closed      bool   `json:"closed"`
+		Due         string `json:"due"`
+		DueComplete bool   `json:"dueComplete"`
+		Labels      []struct {
+			Name  string `json:"name"`
+			Color string `json:"color"`
+		} `json:"labels"`
+	} `json:"cards"`
+	Checklists []struct {
+		IDCard     string `json:"idCard"`
+		Name       string `json:"name"`
+		CheckItems []struct {
+			Name  string  `json:"name"`
+			State string  `json:"state"`
+			Pos   float64 `json:"pos"`
+		} `json:"checkItems"`
+	} `json:"checklists"`
+}
+
+// cards in lists with these names are treated as completed
+var trelloDoneLists = map[string]bool{"done": true, "completed": true, "finished": true}
+
+func parseTrelloExport(r io.Reader) ([]ImportedTask, []ImportRowError, error) {
+	var export trelloExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return nil, nil, err
+	}
+
+	type trelloList struct {
+		name   string
+		closed bool
+	}
+	lists := make(map[string]trelloList)
+	for _, l := range export.Lists {
+		lists[l.ID] = trelloList{name: l.Name, closed: l.Closed}
+	}
+
+	checklists := make(map[string][]int)
+	for i, ch := range export.Checklists {
+		checklists[ch.IDCard] = append(checklists[ch.IDCard], i)
+	}
+
+	var tasks []ImportedTask
+	for i, card := range export.Cards {
+		list := lists[card.IDList]
+		//archived cards and lists are not imported
+		if card.Closed || list.closed {
+			continue
+		}
+
+		var tags []string
+		if export.Name != "" {
+			tags = append(tags, export.Name)
+		}
+		for _, label := range card.Labels {
+			if label.Name != "" {
+				tags = append(tags, label.Name)
+			} else if label.Color != "" {
+				tags = append(tags, label.Color)
+			}
+		}
+
+		description := card.Desc
+		for _, index := range checklists[card.ID] {
+			ch := export.Checklists[index]
+			checkItems := ch.CheckItems
+			sort.SliceStable(checkItems, func(a, b int) bool { return checkItems[a].Pos < checkItems[b].Pos })
+
+			items := make([]checklistItem, 0, len(checkItems))
+			for _, item := range checkItems {
+				items = append(items, checklistItem{Name: item.Name, Checked: item.State == "complete"})
+			}
+			description = appendChecklist(description, ch.Name, items)
+		}
+
+		tasks = append(tasks, ImportedTask{
+			Row:         i + 1,
+			Title:       strings.TrimSpace(card.Name),
+			Description: description,
+			Completed:   card.DueComplete || trelloDoneLists[strings.ToLower(strings.TrimSpace(list.name))],
+			DueDate:     parseExternalDate(card.Due),
+			Tags:        tags,
+		})
+	}
+
+	return tasks, nil, nil
+}
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTodoistExport(t *testing.T) {
+	export := `{
+		"projects": [{"id": "p1", "name": "Home"}, {"id": 2, "name": "Work"}],
+		"labels": [{"id": 7, "name": "urgent"}],
+		"items": [
+			{"id": "w1", "content": "Report", "project_id": 2, "child_order": 1, "checked": 0},
+			{"id": "h2", "content": "Clean", "project_id": "p1", "child_order": 2, "checked": true, "labels": [7]},
+			{"id": "h1", "content": " Shop ", "description": "weekly", "project_id": "p1", "child_order": 1,
+				"due": {"date": "2024-05-10"}},
+			{"id": "s2", "content": "bread", "parent_id": "h1", "child_order": 2, "checked": 1},
+			{"id": "s1", "content": "milk", "parent_id": "h1", "child_order": 1},
+			{"id": "g1", "content": "oat milk", "parent_id": "s1", "child_order": 1},
+			{"id": "o1", "content": "orphan", "parent_id": "gone", "child_order": 1}
+		]
+	}`
+
+	tasks, rowErrors, err := ParseExternalTasks(TaskSourceTodoist, strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//projects keep file order, inside project child_order wins
+	titles := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		titles = append(titles, task.Title)
+	}
+	if got := strings.Join(titles, ","); got != "Shop,Clean,Report" {
+		t.Fatalf("titles = %s, want Shop,Clean,Report", got)
+	}
+	for i, task := range tasks {
+		if task.Order != float64(i+1) {
+			t.Errorf("%s: Order = %v, want %v", task.Title, task.Order, i+1)
+		}
+	}
+
+	shop := tasks[0]
+	//grandchild is flattened into checklist of top-level task right under its parent
+	wantDescription := "weekly\n\n- [ ] milk\n- [ ] oat milk\n- [x] bread"
+	if shop.Description != wantDescription {
+		t.Errorf("description = %q, want %q", shop.Description, wantDescription)
+	}
+	if shop.DueDate == nil || shop.DueDate.Format("2006-01-02") != "2024-05-10" {
+		t.Errorf("due = %v", shop.DueDate)
+	}
+	if shop.Row != 3 {
+		t.Errorf("row = %d, want 3", shop.Row)
+	}
+
+	clean := tasks[1]
+	if !clean.Completed || strings.Join(clean.Tags, ",") != "Home,urgent" {
+		t.Errorf("clean = %+v", clean)
+	}
+
+	if len(rowErrors) != 1 || rowErrors[0].Row != 7 {
+		t.Errorf("row errors = %+v, want orphan subtask on row 7", rowErrors)
+	}
+}
+
+func TestParseTrelloExport(t *testing.T) {
+	export := `{
+		"name": "Board",
+		"lists": [{"id": "l1", "name": "To do"}, {"id": "l2", "name": "Done"}, {"id": "l3", "name": "Old", "closed": true}],
+		"cards": [
+			{"id": "c1", "name": "Plan", "desc": "notes", "idList": "l1", "due": "2024-05-10T09:00:00.000Z",
+				"labels": [{"name": "work"}, {"name": "", "color": "red"}]},
+			{"id": "c2", "name": "Ship", "idList": "l2"},
+			{"id": "c3", "name": "Archived", "idList": "l1", "closed": true},
+			{"id": "c4", "name": "In old list", "idList": "l3"}
+		],
+		"checklists": [
+			{"idCard": "c1", "name": "Steps", "checkItems": [
+				{"name": "second", "state": "incomplete", "pos": 2},
+				{"name": "first", "state": "complete", "pos": 1}
+			]}
+		]
+	}`
+
+	tasks, rowErrors, err := ParseExternalTasks(TaskSourceTrello, strings.NewReader(export))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rowErrors) != 0 {
+		t.Errorf("row errors = %+v", rowErrors)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("got %d tasks, want 2: %+v", len(tasks), tasks)
+	}
+
+	plan := tasks[0]
+	if plan.Description != "notes\n\nSteps:\n- [x] first\n- [ ] second" {
+		t.Errorf("description = %q", plan.Description)
+	}
+	if strings.Join(plan.Tags, ",") != "Board,work,red" {
+		t.Errorf("tags = %v", plan.Tags)
+	}
+	if plan.Completed || plan.DueDate == nil {
+		t.Errorf("plan = %+v", plan)
+	}
+
+	if ship := tasks[1]; ship.Title != "Ship" || !ship.Completed || ship.Row != 2 {
+		t.Errorf("ship = %+v", ship)
+	}
+}
+
+func TestParseExternalTasksUnknownSource(t *testing.T) {
+	if _, _, err := ParseExternalTasks("asana", strings.NewReader("{}")); err != ErrUnknownTaskSource {
+		t.Errorf("error = %v, want ErrUnknownTaskSource", err)
+	}
+}
@@ -0,0 +1,326 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"server/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TaskQueryMaxLength = 255
+	TaskQueryMaxTerms  = 20
+)
+
+// fields of task query, flags are written as bare words like "completed" or "is:completed"
+const (
+	TaskQueryText       = "text"
+	TaskQueryTag        = "tag"
+	TaskQueryPriority   = "priority"
+	TaskQueryEstimate   = "estimate"
+	TaskQueryDue        = "due"
+	TaskQueryCreated    = "created"
+	TaskQueryCompleted  = "completed"
+	TaskQueryBlocked    = "blocked"
+	TaskQueryActionable = "actionable"
+	TaskQueryInbox      = "inbox"
+	TaskQueryDeferred   = "deferred"
+	TaskQueryArchived   = "archived"
+)
+
+var taskQueryFlags = map[string]bool{
+	TaskQueryCompleted:  true,
+	TaskQueryBlocked:    true,
+	TaskQueryActionable: true,
+	TaskQueryInbox:      true,
+	TaskQueryDeferred:   true,
+	TaskQueryArchived:   true,
+}
+
+var taskQueryPriorities = map[string]uint8{
+	"none":   models.TaskPriorityNone,
+	"low":    models.TaskPriorityLow,
+	"medium": models.TaskPriorityMedium,
+	"med":    models.TaskPriorityMedium,
+	"high":   models.TaskPriorityHigh,
+}
+
+var (
+	taskQueryTermRegex     = regexp.MustCompile(`^([a-z]+)(:|>=|<=|>|<|=)(.+)$`)
+	taskQueryRelativeRegex = regexp.MustCompile(`^([+-]?\d{1,3})([dw])$`)
+)
+
+// one condition of task query, all terms of query must match.
+// dates are resolved to range [From, To), nil side is open
+type TaskQueryTerm struct {
+	Field   string
+	Op      string
+	Negated bool
+
+	Text   string
+	Number int
+	None   bool
+	From   *time.Time
+	To     *time.Time
+}
+
+// parsed query like "tag:work priority>=high due<7d -completed"
+type TaskQuery struct {
+	Terms []TaskQueryTerm
+}
+
+// wrong part of query, shown to user as is
+type TaskQueryError struct {
+	Term   string
+	Reason string
+}
+
+func (e TaskQueryError) Error() string {
+	return fmt.Sprintf("%s: %q", e.Reason, e.Term)
+}
+
+// true if query has term with field, negated or not
+func (q TaskQuery) Has(field string) bool {
+	for _, term := range q.Terms {
+		if term.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// canonical form with resolved dates, same filter gives same string in any term order
+func (q TaskQuery) String() string {
+	parts := make([]string, 0, len(q.Terms))
+	for _, term := range q.Terms {
+		parts = append(parts, term.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+func (t TaskQueryTerm) String() string {
+	prefix := ""
+	if t.Negated {
+		prefix = "-"
+	}
+
+	switch t.Field {
+	case TaskQueryText, TaskQueryTag:
+		return prefix + t.Field + "=" + strconv.Quote(t.Text)
+	case TaskQueryPriority, TaskQueryEstimate:
+		return prefix + t.Field + t.Op + strconv.Itoa(t.Number)
+	case TaskQueryDue, TaskQueryCreated:
+		if t.None {
+			return prefix + t.Field + "=none"
+		}
+		return prefix + t.Field + "=" + formatQueryBound(t.From) + ".." + formatQueryBound(t.To)
+	}
+	return prefix + t.Field
+}
+
+func formatQueryBound(bound *time.Time) string {
+	if bound == nil {
+		return ""
+	}
+	return bound.UTC().Format(time.RFC3339)
+}
+
+// split query into words, text in double quotes stays one word
+func splitTaskQuery(text string) ([]string, error) {
+	var words []string
+	var current strings.Builder
+	quoted := false
+
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			current.WriteRune(r)
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if current.Len() > 0 {
+				words = append(words, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, TaskQueryError{Term: current.String(), Reason: "Missing closing quote"}
+	}
+	if current.Len() > 0 {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
+
+// day value of date field: today, tomorrow, yesterday, 2024-05-01 or days/weeks from today like 7d, -2w
+func parseQueryDay(value string, today time.Time, loc *time.Location) (time.Time, bool) {
+	switch value {
+	case "today":
+		return today, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true
+	}
+
+	if match := taskQueryRelativeRegex.FindStringSubmatch(value); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return time.Time{}, false
+		}
+		if match[2] == "w" {
+			n *= 7
+		}
+		return today.AddDate(0, 0, n), true
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// range of moments matching comparison with whole day
+func dayRange(op string, day time.Time) (*time.Time, *time.Time) {
+	next := day.AddDate(0, 0, 1)
+	switch op {
+	case "<":
+		return nil, &day
+	case "<=":
+		return nil, &next
+	case ">":
+		return &next, nil
+	case ">=":
+		return &day, nil
+	}
+	return &day, &next
+}
+
+func parseQueryNumber(field string, value string) (int, bool) {
+	if field == TaskQueryPriority {
+		if priority, ok := taskQueryPriorities[value]; ok {
+			return int(priority), true
+		}
+		n, err := strconv.Atoi(value)
+		return n, err == nil && n >= int(models.TaskPriorityNone) && n <= int(models.TaskPriorityHigh)
+	}
+
+	n, err := strconv.Atoi(value)
+	return n, err == nil && n >= 0 && n <= QuickAddMaxEstimate
+}
+
+// parse one word of query, dates are read in loc
+func parseTaskQueryTerm(word string, today time.Time, loc *time.Location) (TaskQueryTerm, error) {
+	term := TaskQueryTerm{Op: "="}
+	raw := word
+
+	if strings.HasPrefix(word, "-") && len(word) > 1 {
+		term.Negated = true
+		word = word[1:]
+	}
+
+	//quoted phrase is searched as is
+	if strings.HasPrefix(word, `"`) {
+		term.Field = TaskQueryText
+		term.Text = strings.Trim(word, `"`)
+		if term.Text == "" {
+			return term, TaskQueryError{Term: raw, Reason: "Empty phrase"}
+		}
+		return term, nil
+	}
+
+	lower := strings.ToLower(word)
+	if taskQueryFlags[lower] {
+		term.Field = lower
+		return term, nil
+	}
+
+	match := taskQueryTermRegex.FindStringSubmatch(lower)
+	if match == nil {
+		term.Field = TaskQueryText
+		term.Text = word
+		return term, nil
+	}
+
+	field, op, value := match[1], match[2], strings.Trim(match[3], `"`)
+	if op == ":" {
+		op = "="
+	}
+	term.Field = field
+	term.Op = op
+
+	switch field {
+	case "is":
+		if op != "=" || !taskQueryFlags[value] {
+			return term, TaskQueryError{Term: raw, Reason: "Unknown flag"}
+		}
+		term.Field = value
+	case TaskQueryTag:
+		if op != "=" {
+			return term, TaskQueryError{Term: raw, Reason: "Tag can only be matched with ':'"}
+		}
+		tags := models.NormalizeTags([]string{value})
+		if len(tags) == 0 {
+			return term, TaskQueryError{Term: raw, Reason: "Empty tag"}
+		}
+		term.Text = tags[0]
+	case TaskQueryPriority, TaskQueryEstimate:
+		n, ok := parseQueryNumber(field, value)
+		if !ok {
+			return term, TaskQueryError{Term: raw, Reason: "Wrong " + field}
+		}
+		term.Number = n
+	case TaskQueryDue, TaskQueryCreated:
+		if value == "none" {
+			if op != "=" || field == TaskQueryCreated {
+				return term, TaskQueryError{Term: raw, Reason: "Wrong date"}
+			}
+			term.None = true
+			break
+		}
+		day, ok := parseQueryDay(value, today, loc)
+		if !ok {
+			return term, TaskQueryError{Term: raw, Reason: "Wrong date"}
+		}
+		term.From, term.To = dayRange(op, day)
+	default:
+		return term, TaskQueryError{Term: raw, Reason: "Unknown field"}
+	}
+
+	return term, nil
+}
+
+// length limit of query typed by user, checked before it is parsed or combined with other queries
+func IsValidTaskQueryLength(text string) bool {
+	return len(text) <= TaskQueryMaxLength
+}
+
+// parse task query, relative dates like "today" or "7d" are days in loc counted from now
+func ParseTaskQuery(text string, now time.Time, loc *time.Location) (TaskQuery, error) {
+	var query TaskQuery
+
+	words, err := splitTaskQuery(text)
+	if err != nil {
+		return query, err
+	}
+	if len(words) > TaskQueryMaxTerms {
+		return query, TaskQueryError{Term: words[TaskQueryMaxTerms], Reason: "Query can have max " + strconv.Itoa(TaskQueryMaxTerms) + " terms"}
+	}
+
+	today := StartOfDay(now, loc)
+	for _, word := range words {
+		term, err := parseTaskQueryTerm(word, today, loc)
+		if err != nil {
+			return query, err
+		}
+		query.Terms = append(query.Terms, term)
+	}
+	return query, nil
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"errors"
+	"server/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseTestQuery(t *testing.T, text string) TaskQuery {
+	t.Helper()
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	now := time.Date(2024, 5, 10, 22, 30, 0, 0, loc)
+
+	query, err := ParseTaskQuery(text, now, loc)
+	if err != nil {
+		t.Fatalf("ParseTaskQuery(%q) error = %v", text, err)
+	}
+	return query
+}
+
+func TestParseTaskQueryTerms(t *testing.T) {
+	query := parseTestQuery(t, `tag:Work priority>=high estimate<3 -completed is:inbox "buy milk" report`)
+
+	want := []TaskQueryTerm{
+		{Field: TaskQueryTag, Op: "=", Text: "work"},
+		{Field: TaskQueryPriority, Op: ">=", Number: int(models.TaskPriorityHigh)},
+		{Field: TaskQueryEstimate, Op: "<", Number: 3},
+		{Field: TaskQueryCompleted, Op: "=", Negated: true},
+		{Field: TaskQueryInbox, Op: "="},
+		{Field: TaskQueryText, Op: "=", Text: "buy milk"},
+		{Field: TaskQueryText, Op: "=", Text: "report"},
+	}
+	if len(query.Terms) != len(want) {
+		t.Fatalf("got %d terms, want %d: %+v", len(query.Terms), len(want), query.Terms)
+	}
+	for i, term := range query.Terms {
+		if term.Field != want[i].Field || term.Op != want[i].Op || term.Negated != want[i].Negated ||
+			term.Text != want[i].Text || term.Number != want[i].Number {
+			t.Errorf("term %d = %+v, want %+v", i, term, want[i])
+		}
+	}
+}
+
+// dates are whole days in time zone of user, not of server
+func TestParseTaskQueryDates(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	day := func(d int) *time.Time {
+		v := time.Date(2024, 5, d, 0, 0, 0, 0, loc)
+		return &v
+	}
+
+	tests := []struct {
+		text string
+		from *time.Time
+		to   *time.Time
+		none bool
+	}{
+		{"due:today", day(10), day(11), false},
+		{"due:tomorrow", day(11), day(12), false},
+		{"created:yesterday", day(9), day(10), false},
+		{"due<7d", nil, day(17), false},
+		{"due<=1w", nil, day(18), false},
+		{"due>2024-05-20", day(21), nil, false},
+		{"due>=-2d", day(8), nil, false},
+		{"due:none", nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		query := parseTestQuery(t, tt.text)
+		term := query.Terms[0]
+		if term.None != tt.none {
+			t.Errorf("%s: None = %v, want %v", tt.text, term.None, tt.none)
+		}
+		if !sameBound(term.From, tt.from) || !sameBound(term.To, tt.to) {
+			t.Errorf("%s: range = [%v, %v), want [%v, %v)", tt.text, term.From, term.To, tt.from, tt.to)
+		}
+	}
+}
+
+func sameBound(a *time.Time, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+func TestParseTaskQueryErrors(t *testing.T) {
+	loc := time.UTC
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, loc)
+
+	tests := []struct {
+		text string
+		term string
+	}{
+		{`"unclosed phrase`, `"unclosed phrase`},
+		{"color:red", "color:red"},
+		{"is:urgent", "is:urgent"},
+		{"priority:huge", "priority:huge"},
+		{"estimate>500", "estimate>500"},
+		{"due:someday", "due:someday"},
+		{"created:none", "created:none"},
+		{"tag>work", "tag>work"},
+		{`""`, `""`},
+		{strings.Repeat("a ", TaskQueryMaxTerms+1), "a"},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseTaskQuery(tt.text, now, loc)
+		var queryErr TaskQueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("ParseTaskQuery(%q) error = %v, want TaskQueryError", tt.text, err)
+			continue
+		}
+		if queryErr.Term != tt.term {
+			t.Errorf("ParseTaskQuery(%q) error term = %q, want %q", tt.text, queryErr.Term, tt.term)
+		}
+	}
+}
+
+// same filter in other order or spelling gives same cache key
+func TestTaskQueryCanonicalString(t *testing.T) {
+	a := parseTestQuery(t, "tag:work -completed priority>=high")
+	b := parseTestQuery(t, "tag:work completed priority>=high")
+	c := parseTestQuery(t, "-is:completed TAG:Work priority>=3")
+
+	if a.String() != c.String() {
+		t.Errorf("String() differs for same filter:\n%s\n%s", a.String(), c.String())
+	}
+	if a.String() == b.String() {
+		t.Errorf("String() is same for different filters: %s", a.String())
+	}
+}
+
+func TestIsValidTaskQueryLength(t *testing.T) {
+	if !IsValidTaskQueryLength(strings.Repeat("a", TaskQueryMaxLength)) {
+		t.Error("query of max length must be valid")
+	}
+	if IsValidTaskQueryLength(strings.Repeat("a", TaskQueryMaxLength+1)) {
+		t.Error("query over max length must be invalid")
+	}
+}
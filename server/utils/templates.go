@@ -0,0 +1,25 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// variables which can be used in titles and descriptions of task templates
+var TaskTemplateVariables = []string{"{{date}}", "{{weekday}}", "{{week}}", "{{month}}", "{{year}}"}
+
+// fill template variables with values of now in loc, unknown ones are left as is
+func RenderTaskTemplate(text string, now time.Time, loc *time.Location) string {
+	now = now.In(loc)
+	_, week := now.ISOWeek()
+
+	replacer := strings.NewReplacer(
+		"{{date}}", now.Format("2006-01-02"),
+		"{{weekday}}", now.Weekday().String(),
+		"{{week}}", strconv.Itoa(week),
+		"{{month}}", now.Month().String(),
+		"{{year}}", strconv.Itoa(now.Year()),
+	)
+	return replacer.Replace(text)
+}
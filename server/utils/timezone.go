@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"time"
+
+	//zone database is embedded, production image has no tzdata
+	_ "time/tzdata"
+)
+
+// checks that name is a known IANA time zone like "Europe/Riga"
+func IsValidTimeZone(name string) bool {
+	if name == "" || name == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+// midnight of the day t falls on in loc
+func StartOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// number of calendar days from a to b in loc, days with DST change still count as one
+func DaysBetween(a time.Time, b time.Time, loc *time.Location) int {
+	a = a.In(loc)
+	b = b.In(loc)
+	dayA := time.Date(a.Year(), a.Month(), a.Day(), 0, 0, 0, 0, time.UTC)
+	dayB := time.Date(b.Year(), b.Month(), b.Day(), 0, 0, 0, 0, time.UTC)
+	return int(dayB.Sub(dayA).Hours() / 24)
+}
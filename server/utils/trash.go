@@ -0,0 +1,21 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultTrashRetentionDays = 30
+	TrashPurgeInterval        = 1 * time.Hour
+)
+
+// how long a deleted task stays in trash, configurable with TASKS_TRASH_RETENTION_DAYS
+func TrashRetention() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("TASKS_TRASH_RETENTION_DAYS"))
+	if err != nil || days < 1 {
+		days = DefaultTrashRetentionDays
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
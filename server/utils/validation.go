@@ -43,3 +43,7 @@ func IsValidDescription(description string) bool {
 
 	return isLongEnough
 }
+
+func IsValidComment(body string) bool {
+	return len(body) >= 1 && len(body) <= 2000
+}